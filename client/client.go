@@ -3,6 +3,10 @@ package client
 import (
 	"errors"
 	"io"
+	"strings"
+	"syscall"
+
+	"github.com/athos/trenchman/bencode"
 )
 
 type (
@@ -31,7 +35,39 @@ type (
 	// EvalResult is either string or RuntimeError
 	EvalResult   interface{}
 	RuntimeError struct {
-		err string
+		err     string
+		details *ErrorDetails
+	}
+
+	// ErrorDetails describes an evaluation error, as clojure.main/ex-triage
+	// does. Any of the fields may be empty if not known.
+	ErrorDetails struct {
+		Class  string
+		Phase  string
+		Source string
+		Line   int
+		Column int
+	}
+
+	// ErrorTriager is implemented by clients that can retrieve the details
+	// of the last evaluation error from the server afterwards.
+	ErrorTriager interface {
+		TriageLastError() (*ErrorDetails, error)
+	}
+
+	// OpSender is implemented by clients that can send arbitrary ops to
+	// the server, such as the ones provided by nREPL middleware. The
+	// channel receives all the responses to the op, and is closed once
+	// the op is done. The caller must receive all the responses, even
+	// if it is no longer interested in them.
+	OpSender interface {
+		SendOp(req map[string]interface{}) <-chan map[string]interface{}
+	}
+
+	// SessionHolder is implemented by clients that evaluate code in a
+	// session on the server.
+	SessionHolder interface {
+		Session() string
 	}
 
 	Client interface {
@@ -49,18 +85,75 @@ type (
 		Err(s string)
 		Debug(s string)
 	}
+
+	// ExceptionReporter is implemented by OutputHandlers that may report
+	// evaluation errors by themselves (e.g. as JSON events). Clients don't
+	// print the messages of evaluation errors as err output to them if
+	// ReportsExceptions returns true.
+	ExceptionReporter interface {
+		ReportsExceptions() bool
+	}
 )
 
 var ErrDisconnected = errors.New("disconnected")
 
+// ReportsExceptions reports whether the output handler reports evaluation
+// errors by itself.
+func ReportsExceptions(handler OutputHandler) bool {
+	reporter, ok := handler.(ExceptionReporter)
+	return ok && reporter.ReportsExceptions()
+}
+
+// HasStatus reports whether the response to an op sent via OpSender has
+// the status.
+func HasStatus(resp map[string]interface{}, status string) bool {
+	statuses, _ := resp["status"].([]bencode.Datum)
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDisconnected reports whether the error indicates that the connection
+// to the server has been lost.
+func IsDisconnected(err error) bool {
+	return err == ErrDisconnected ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
 func NewRuntimeError(err string) *RuntimeError {
-	return &RuntimeError{err}
+	return &RuntimeError{err: err}
+}
+
+func NewRuntimeErrorWithDetails(err string, details *ErrorDetails) *RuntimeError {
+	return &RuntimeError{err, details}
 }
 
 func (e *RuntimeError) Error() string {
 	return e.err
 }
 
+// Details returns the details of the error, or nil if not available.
+func (e *RuntimeError) Details() *ErrorDetails {
+	return e.details
+}
+
+// IsSyntaxError reports whether the error occurred while reading or
+// compiling code, as opposed to while executing it.
+func (d *ErrorDetails) IsSyntaxError() bool {
+	switch d.Phase {
+	case "read-source", "macro-syntax-check", "macroexpansion", "compile-syntax-check", "compilation":
+		return true
+	case "":
+		return strings.HasSuffix(d.Class, "ReaderException")
+	default:
+		return false
+	}
+}
+
 func StartLoop(transport Transport, handler Handler, done chan struct{}) {
 	for {
 		resp, err := transport.Recv()
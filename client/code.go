@@ -0,0 +1,30 @@
+package client
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PrintBindings are the bindings to print values in full as data, which
+// can be read back, regardless of the settings of the session.
+const PrintBindings = `*print-length* nil *print-level* nil *print-meta* false *print-namespace-maps* false`
+
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// QuoteString returns the Clojure string literal representing s.
+func QuoteString(s string) string {
+	return `"` + stringEscaper.Replace(s) + `"`
+}
+
+// LoadFileCode builds the code to load the content as the file at the path
+// via Compiler/load, so that the forms get the file name and line numbers
+// just as when loaded from the file.
+func LoadFileCode(path, content string) string {
+	return fmt.Sprintf(
+		"(clojure.lang.Compiler/load (java.io.StringReader. %s) %s %s)",
+		QuoteString(content),
+		QuoteString(path),
+		QuoteString(filepath.Base(path)),
+	)
+}
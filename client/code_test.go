@@ -0,0 +1,29 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foo", `"foo"`},
+		{`"foo"`, `"\"foo\""`},
+		{`C:\foo`, `"C:\\foo"`},
+		{"foo\n\tbar\r\n", `"foo\n\tbar\r\n"`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, QuoteString(tt.input))
+	}
+}
+
+func TestLoadFileCode(t *testing.T) {
+	assert.Equal(t,
+		`(clojure.lang.Compiler/load (java.io.StringReader. "(ns foo.core)\n(println \"foo\")\n") "/src/foo/core.clj" "core.clj")`,
+		LoadFileCode("/src/foo/core.clj", "(ns foo.core)\n(println \"foo\")\n"),
+	)
+}
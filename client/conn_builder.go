@@ -1,9 +1,8 @@
 package client
 
 import (
-	"fmt"
 	"net"
-	"time"
+	"strconv"
 )
 
 type ConnBuilder interface {
@@ -11,16 +10,25 @@ type ConnBuilder interface {
 }
 
 type TCPConnBuilder struct {
-	Host string
-	Port int
+	Host   string
+	Port   int
+	Dialer Dialer
 }
 
 type UnixConnBuilder struct {
 	Path string
 }
 
+func (builder *TCPConnBuilder) String() string {
+	return net.JoinHostPort(builder.Host, strconv.Itoa(builder.Port))
+}
+
 func (builder *TCPConnBuilder) Connect() (net.Conn, error) {
-	return net.Dial("tcp", fmt.Sprintf("%s:%d", builder.Host, builder.Port))
+	return dialerOrDefault(builder.Dialer).Dial("tcp", net.JoinHostPort(builder.Host, strconv.Itoa(builder.Port)))
+}
+
+func (builder *UnixConnBuilder) String() string {
+	return builder.Path
 }
 
 func (builder *UnixConnBuilder) Connect() (net.Conn, error) {
@@ -32,25 +40,3 @@ type ConnBuilderFunc func() (net.Conn, error)
 func (f ConnBuilderFunc) Connect() (net.Conn, error) {
 	return f()
 }
-
-func NewRetryConnBuilder(connBuilder ConnBuilder, timeout time.Duration, interval time.Duration) ConnBuilder {
-	if interval > timeout {
-		interval = timeout
-	}
-	return ConnBuilderFunc(func() (conn net.Conn, err error) {
-		end := time.Now().Add(timeout)
-		for {
-			conn, err = connBuilder.Connect()
-			if err == nil {
-				return conn, nil
-			}
-			if time.Now().After(end) {
-				return
-			}
-			time.Sleep(interval)
-			if time.Now().After(end) {
-				return
-			}
-		}
-	})
-}
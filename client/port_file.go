@@ -0,0 +1,124 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// PortFileConnBuilder reads the port to connect to from the port file
+	// on every connection attempt, so that it can wait for the port file
+	// to be created (or updated) by a server that is starting up.
+	//
+	// A port file that already exists on the first attempt is used if the
+	// server is reachable. Otherwise, it's considered stale (e.g. left by
+	// a server that died), and ignored until it changes.
+	PortFileConnBuilder struct {
+		Path string
+		// Build returns the ConnBuilder connecting to the given port.
+		Build func(port int) (ConnBuilder, error)
+
+		lock      sync.Mutex
+		port      int
+		builder   ConnBuilder
+		attempted bool
+		stale     *portFileState
+	}
+
+	portFileState struct {
+		modTime time.Time
+		content string
+	}
+)
+
+var (
+	errEmptyPortFile = errors.New("port file is empty")
+	errStalePortFile = errors.New("port file is not updated yet")
+)
+
+func ReadPortFile(path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return parsePort(string(content))
+}
+
+func parsePort(content string) (int, error) {
+	s := strings.TrimSpace(content)
+	if s == "" {
+		// the server may be in the middle of writing the file
+		return 0, errEmptyPortFile
+	}
+	return strconv.Atoi(s)
+}
+
+func (builder *PortFileConnBuilder) String() string {
+	builder.lock.Lock()
+	defer builder.lock.Unlock()
+	if builder.builder != nil {
+		return Describe(builder.builder)
+	}
+	return fmt.Sprintf("the port in %s", builder.Path)
+}
+
+func readPortFileState(path string) (*portFileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &portFileState{info.ModTime(), string(content)}, nil
+}
+
+func (builder *PortFileConnBuilder) resolve() (ConnBuilder, *portFileState, error) {
+	state, err := readPortFileState(builder.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read port file %s (%w)", builder.Path, err)
+	}
+	builder.lock.Lock()
+	defer builder.lock.Unlock()
+	if stale := builder.stale; stale != nil && state.modTime.Equal(stale.modTime) && state.content == stale.content {
+		return nil, nil, fmt.Errorf("could not read port file %s (%w)", builder.Path, errStalePortFile)
+	}
+	port, err := parsePort(state.content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read port file %s (%w)", builder.Path, err)
+	}
+	if builder.builder == nil || port != builder.port {
+		b, err := builder.Build(port)
+		if err != nil {
+			return nil, nil, err
+		}
+		builder.port = port
+		builder.builder = b
+	}
+	return builder.builder, state, nil
+}
+
+func (builder *PortFileConnBuilder) Connect() (net.Conn, error) {
+	b, state, err := builder.resolve()
+	builder.lock.Lock()
+	first := !builder.attempted
+	builder.attempted = true
+	builder.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := b.Connect()
+	if err != nil && first {
+		builder.lock.Lock()
+		builder.stale = state
+		builder.lock.Unlock()
+	}
+	return conn, err
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortFileConnBuilder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".nrepl-port")
+	port := startEchoServer(t)
+	ports := []int{}
+	builder := &PortFileConnBuilder{
+		Path: path,
+		Build: func(port int) (ConnBuilder, error) {
+			ports = append(ports, port)
+			return &TCPConnBuilder{Host: "127.0.0.1", Port: port}, nil
+		},
+	}
+
+	_, err := builder.Connect()
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.True(t, IsRetryable(err))
+
+	writeFile(t, dir, ".nrepl-port", []byte(""))
+	_, err = builder.Connect()
+	assert.True(t, IsRetryable(err))
+
+	writeFile(t, dir, ".nrepl-port", []byte("foo"))
+	_, err = builder.Connect()
+	assert.NotNil(t, err)
+	assert.False(t, IsRetryable(err))
+
+	writeFile(t, dir, ".nrepl-port", []byte(strconv.Itoa(port)+"\n"))
+	for i := 0; i < 2; i++ {
+		conn, err := builder.Connect()
+		assert.Nil(t, err)
+		conn.Close()
+	}
+	assert.Equal(t, []int{port}, ports)
+	assert.Equal(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), builder.String())
+}
+
+func TestPortFileConnBuilderIgnoresStalePortFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".nrepl-port")
+	stale := listen(t)
+	stalePort := stale.Addr().(*net.TCPAddr).Port
+	stale.Close()
+	writeFile(t, dir, ".nrepl-port", []byte(strconv.Itoa(stalePort)))
+	attempts := 0
+	builder := &PortFileConnBuilder{
+		Path: path,
+		Build: func(port int) (ConnBuilder, error) {
+			return ConnBuilderFunc(func() (net.Conn, error) {
+				attempts++
+				return net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+			}), nil
+		},
+	}
+	_, err := builder.Connect()
+	assert.NotNil(t, err)
+	// the port file left as it is is not dialed any more
+	_, err = builder.Connect()
+	assert.True(t, errors.Is(err, errStalePortFile))
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 1, attempts)
+
+	port := startEchoServer(t)
+	writeFile(t, dir, ".nrepl-port", []byte(strconv.Itoa(port)))
+	conn, err := builder.Connect()
+	assert.Nil(t, err)
+	conn.Close()
+	assert.Equal(t, 2, attempts)
+}
+
+func TestPortFileConnBuilderUsesExistingPortFile(t *testing.T) {
+	dir := t.TempDir()
+	port := startEchoServer(t)
+	writeFile(t, dir, ".nrepl-port", []byte(strconv.Itoa(port)))
+	builder := &PortFileConnBuilder{
+		Path: filepath.Join(dir, ".nrepl-port"),
+		Build: func(port int) (ConnBuilder, error) {
+			return &TCPConnBuilder{Host: "127.0.0.1", Port: port}, nil
+		},
+	}
+	conn, err := builder.Connect()
+	assert.Nil(t, err)
+	conn.Close()
+}
+
+func TestRetryPortFileConnBuilder(t *testing.T) {
+	dir := t.TempDir()
+	port := startEchoServer(t)
+	stale := listen(t)
+	stalePort := stale.Addr().(*net.TCPAddr).Port
+	stale.Close()
+	writeFile(t, dir, ".nrepl-port", []byte(strconv.Itoa(stalePort)))
+	builder := NewRetryConnBuilderWithPolicy(&PortFileConnBuilder{
+		Path: filepath.Join(dir, ".nrepl-port"),
+		Build: func(port int) (ConnBuilder, error) {
+			return &TCPConnBuilder{Host: "127.0.0.1", Port: port}, nil
+		},
+	}, &RetryPolicy{Timeout: 5 * time.Second, Interval: 10 * time.Millisecond})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(filepath.Join(dir, ".nrepl-port"), []byte(strconv.Itoa(port)), 0600)
+	}()
+	conn, err := builder.Connect()
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	assert.Nil(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
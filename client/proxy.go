@@ -0,0 +1,331 @@
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type (
+	Dialer interface {
+		Dial(network, addr string) (net.Conn, error)
+	}
+
+	socks5Dialer struct {
+		addr     string
+		username string
+		password string
+		// resolveLocally is true if hostnames are resolved on the client
+		// side (socks5), rather than by the proxy (socks5h)
+		resolveLocally bool
+	}
+
+	httpConnectDialer struct {
+		addr string
+		auth string
+		// tlsConfig is non-nil if the connection to the proxy itself is
+		// secured with TLS (https)
+		tlsConfig *tls.Config
+	}
+
+	bufferedConn struct {
+		net.Conn
+		reader *bufio.Reader
+	}
+)
+
+func dialerOrDefault(dialer Dialer) Dialer {
+	if dialer == nil {
+		return &net.Dialer{}
+	}
+	return dialer
+}
+
+func defaultPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// NewProxyDialer returns a Dialer that connects through the proxy
+// specified by the URL. The supported schemes are socks5, socks5h, http and
+// https. With https, the connection to the proxy is secured with TLS.
+func NewProxyDialer(proxyURL *url.URL) (Dialer, error) {
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		d := &socks5Dialer{
+			addr:           defaultPort(proxyURL, "1080"),
+			resolveLocally: proxyURL.Scheme == "socks5",
+		}
+		if user := proxyURL.User; user != nil {
+			d.username = user.Username()
+			d.password, _ = user.Password()
+		}
+		return d, nil
+	case "http", "https":
+		d := &httpConnectDialer{addr: defaultPort(proxyURL, "80")}
+		if proxyURL.Scheme == "https" {
+			d.addr = defaultPort(proxyURL, "443")
+			d.tlsConfig = &tls.Config{ServerName: proxyURL.Hostname()}
+		}
+		if user := proxyURL.User; user != nil {
+			password, _ := user.Password()
+			credential := user.Username() + ":" + password
+			d.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(credential))
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf(
+			"unsupported proxy scheme %q in %s (supported schemes: socks5, socks5h, http, https)",
+			proxyURL.Scheme,
+			proxyURL.Redacted(),
+		)
+	}
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func matchesNoProxy(host, noProxy string) bool {
+	for _, pattern := range strings.Split(noProxy, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if pattern == "*" {
+			return true
+		}
+		if h, _, err := net.SplitHostPort(pattern); err == nil {
+			pattern = h
+		}
+		if host == pattern ||
+			strings.HasSuffix(host, "."+strings.TrimPrefix(pattern, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+func getenv(lookup func(string) (string, bool), names ...string) string {
+	for _, name := range names {
+		if v, ok := lookup(name); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ProxyURLFromEnvironment returns the proxy URL to use for connecting to
+// the given host according to the ALL_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables. Connections to loopback addresses never go
+// through proxies. It returns nil if no proxy should be used.
+func ProxyURLFromEnvironment(host string) (*url.URL, error) {
+	return proxyURLFromEnvironment(host, os.LookupEnv)
+}
+
+func proxyURLFromEnvironment(host string, lookup func(string) (string, bool)) (*url.URL, error) {
+	host = strings.ToLower(host)
+	if host == "" || isLoopback(host) {
+		return nil, nil
+	}
+	if matchesNoProxy(host, getenv(lookup, "NO_PROXY", "no_proxy")) {
+		return nil, nil
+	}
+	proxy := getenv(lookup, "ALL_PROXY", "all_proxy", "HTTPS_PROXY", "https_proxy")
+	if proxy == "" {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	ret, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %s (%w)", proxy, err)
+	}
+	return ret, nil
+}
+
+// resolveHost returns the IP address of the host, preferring IPv4.
+func resolveHost(host string) (string, error) {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return ips[0].String(), nil
+}
+
+func (d *socks5Dialer) Dial(network, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	if d.resolveLocally && net.ParseIP(host) == nil {
+		if host, err = resolveHost(host); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := net.Dial(network, d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.handshake(conn, host, port); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS5 proxy %s: %w", d.addr, err)
+	}
+	return conn, nil
+}
+
+func (d *socks5Dialer) handshake(conn net.Conn, host string, port int) error {
+	methods := []byte{0x00}
+	if d.username != "" {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != 0x05 {
+		return fmt.Errorf("unexpected protocol version: %d", buf[0])
+	}
+	switch buf[1] {
+	case 0x00:
+	case 0x02:
+		if d.username == "" {
+			return errors.New("authentication required")
+		}
+		req := []byte{0x01, byte(len(d.username))}
+		req = append(req, d.username...)
+		req = append(req, byte(len(d.password)))
+		req = append(req, d.password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0x00 {
+			return errors.New("authentication failed")
+		}
+	default:
+		return errors.New("no acceptable authentication method")
+	}
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, 0x01)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	switch header[1] {
+	case 0x00:
+	case 0x05:
+		return fmt.Errorf("connection request failed (%w)", syscall.ECONNREFUSED)
+	default:
+		return fmt.Errorf("connection request failed (code %d)", header[1])
+	}
+	var addrLen int
+	switch header[3] {
+	case 0x01:
+		addrLen = net.IPv4len
+	case 0x04:
+		addrLen = net.IPv6len
+	case 0x03:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		addrLen = int(buf[0])
+	default:
+		return fmt.Errorf("unknown address type: %d", header[3])
+	}
+	// skip the bound address and port
+	_, err := io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := net.Dial(network, d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.tlsConfig != nil {
+		tlsConn := tls.Client(conn, d.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("HTTPS proxy %s: %w", d.addr, err)
+		}
+		conn = tlsConn
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if d.auth != "" {
+		req.Header.Set("Proxy-Authorization", d.auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	// the response body must not be read since it is the tunneled stream
+	// if the request succeeds
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP proxy %s: %s", d.addr, resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{conn, reader}, nil
+	}
+	return conn, nil
+}
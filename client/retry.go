@@ -0,0 +1,187 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	// RetryPolicy specifies how connection attempts are retried.
+	// The interval between attempts starts at Interval and is multiplied by
+	// Multiplier after each attempt, up to MaxInterval. Jitter (0 to 1)
+	// randomizes each interval by the given fraction. Intervals shorter than
+	// MinRetryInterval, including the zero Interval, are rounded up to it so
+	// that retries never busy-loop.
+	RetryPolicy struct {
+		Timeout     time.Duration
+		Interval    time.Duration
+		MaxInterval time.Duration
+		Multiplier  float64
+		Jitter      float64
+		MaxAttempts int
+		DialTimeout time.Duration
+		// Notify, if non-nil, is called after each failed attempt that
+		// will be retried.
+		Notify func(attempt int, err error, wait time.Duration)
+	}
+
+	RetryError struct {
+		Attempts int
+		Err      error
+	}
+)
+
+// MinRetryInterval is the shortest interval between connection attempts.
+const MinRetryInterval = 10 * time.Millisecond
+
+var errDialTimeout = errors.New("connection attempt timed out")
+
+func (e *RetryError) Error() string {
+	if e.Attempts == 1 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (gave up after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether the connection error may be resolved by
+// retrying, e.g. when the server is not listening yet. Errors such as
+// DNS or TLS failures are considered fatal.
+func IsRetryable(err error) bool {
+	if err == ErrDisconnected || err == errDialTimeout ||
+		errors.Is(err, errEmptyPortFile) || errors.Is(err, errStalePortFile) || errors.Is(err, io.EOF) || errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout
+	}
+	var chanErr *ssh.OpenChannelError
+	if errors.As(err, &chanErr) {
+		return chanErr.Reason == ssh.ConnectionFailed
+	}
+	for _, errno := range []syscall.Errno{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.EHOSTUNREACH,
+		syscall.ENETUNREACH,
+		syscall.ENOENT,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Describe returns a human-readable description of the destination of
+// the ConnBuilder.
+func Describe(connBuilder ConnBuilder) string {
+	if s, ok := connBuilder.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return "server"
+}
+
+func connectWithTimeout(connBuilder ConnBuilder, timeout time.Duration) (net.Conn, error) {
+	if timeout <= 0 {
+		return connBuilder.Connect()
+	}
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := connBuilder.Connect()
+		ch <- result{conn, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.conn, res.err
+	case <-time.After(timeout):
+		go func() {
+			if res := <-ch; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, errDialTimeout
+	}
+}
+
+func (p *RetryPolicy) wait(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	wait := float64(p.Interval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && wait > float64(p.MaxInterval) {
+		wait = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		wait *= 1 + jitter*(2*rand.Float64()-1)
+	}
+	if wait < float64(MinRetryInterval) {
+		return MinRetryInterval
+	}
+	return time.Duration(wait)
+}
+
+// NewRetryConnBuilderWithPolicy returns a ConnBuilder that retries
+// connecting according to the policy as long as errors are retryable.
+func NewRetryConnBuilderWithPolicy(connBuilder ConnBuilder, policy *RetryPolicy) ConnBuilder {
+	return ConnBuilderFunc(func() (net.Conn, error) {
+		var end time.Time
+		if policy.Timeout > 0 {
+			end = time.Now().Add(policy.Timeout)
+		}
+		for attempt := 1; ; attempt++ {
+			conn, err := connectWithTimeout(connBuilder, policy.DialTimeout)
+			if err == nil {
+				return conn, nil
+			}
+			if !IsRetryable(err) ||
+				(policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts) {
+				return nil, &RetryError{attempt, err}
+			}
+			wait := policy.wait(attempt)
+			if !end.IsZero() {
+				remaining := time.Until(end)
+				if remaining <= 0 {
+					return nil, &RetryError{attempt, err}
+				}
+				if wait > remaining {
+					wait = remaining
+				}
+			}
+			if policy.Notify != nil {
+				policy.Notify(attempt, err, wait)
+			}
+			time.Sleep(wait)
+		}
+	})
+}
+
+// NewRetryConnBuilder returns a ConnBuilder that retries connecting at
+// a fixed interval until the timeout elapses.
+func NewRetryConnBuilder(connBuilder ConnBuilder, timeout time.Duration, interval time.Duration) ConnBuilder {
+	return NewRetryConnBuilderWithPolicy(connBuilder, &RetryPolicy{
+		Timeout:  timeout,
+		Interval: interval,
+	})
+}
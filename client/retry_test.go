@@ -0,0 +1,116 @@
+package client
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{fmt.Errorf("wrapped (%w)", syscall.ECONNRESET), true},
+		{&os.PathError{Op: "open", Path: ".nrepl-port", Err: os.ErrNotExist}, true},
+		{errDialTimeout, true},
+		{&net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}, false},
+		{&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, true},
+		{x509.UnknownAuthorityError{}, false},
+		{errors.New("something went wrong"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestRetryConnBuilder(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	fatal := &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}
+	tests := []struct {
+		title    string
+		policy   RetryPolicy
+		errs     []error
+		ok       bool
+		attempts int
+	}{
+		{"succeeds after retries", RetryPolicy{Timeout: time.Second}, []error{refused, refused}, true, 3},
+		{"fatal error", RetryPolicy{Timeout: time.Second}, []error{refused, fatal}, false, 2},
+		{"max attempts", RetryPolicy{MaxAttempts: 2}, []error{refused, refused, refused}, false, 2},
+		{
+			"timeout",
+			RetryPolicy{Timeout: 50 * time.Millisecond, Interval: 20 * time.Millisecond, Multiplier: 2},
+			[]error{refused, refused, refused, refused, refused},
+			false,
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			attempts := 0
+			notified := []int{}
+			tt.policy.Notify = func(attempt int, err error, wait time.Duration) {
+				notified = append(notified, attempt)
+			}
+			builder := NewRetryConnBuilderWithPolicy(ConnBuilderFunc(func() (net.Conn, error) {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return nil, tt.errs[attempts-1]
+				}
+				c, _ := net.Pipe()
+				return c, nil
+			}), &tt.policy)
+			conn, err := builder.Connect()
+			assert.Equal(t, tt.attempts, attempts)
+			if tt.ok {
+				assert.Nil(t, err)
+				conn.Close()
+				return
+			}
+			var retryErr *RetryError
+			assert.True(t, errors.As(err, &retryErr))
+			assert.Equal(t, tt.attempts, retryErr.Attempts)
+			assert.Equal(t, tt.attempts-1, len(notified))
+		})
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	policy := &RetryPolicy{Interval: 100 * time.Millisecond, Multiplier: 2, MaxInterval: time.Second}
+	assert.Equal(t, 100*time.Millisecond, policy.wait(1))
+	assert.Equal(t, 400*time.Millisecond, policy.wait(3))
+	assert.Equal(t, time.Second, policy.wait(10))
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		wait := policy.wait(1)
+		assert.True(t, wait >= 50*time.Millisecond && wait <= 150*time.Millisecond)
+	}
+	for _, policy := range []*RetryPolicy{
+		{},
+		{Interval: time.Millisecond, Multiplier: 2},
+		{Interval: MinRetryInterval, Jitter: 1},
+	} {
+		for attempt := 1; attempt <= 3; attempt++ {
+			assert.True(t, policy.wait(attempt) >= MinRetryInterval, "%+v", policy)
+		}
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	builder := NewRetryConnBuilderWithPolicy(ConnBuilderFunc(func() (net.Conn, error) {
+		time.Sleep(time.Second)
+		return nil, errors.New("too late")
+	}), &RetryPolicy{MaxAttempts: 1, DialTimeout: 10 * time.Millisecond})
+	_, err := builder.Connect()
+	assert.Equal(t, errDialTimeout, errors.Unwrap(err))
+}
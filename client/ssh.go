@@ -0,0 +1,161 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type (
+	SSHConnBuilder struct {
+		Host       string
+		Port       int
+		TargetHost string
+		TargetPort int
+		Config     *ssh.ClientConfig
+		Dialer     Dialer
+	}
+
+	SSHOpts struct {
+		User           string
+		AgentSocket    string
+		IdentityFiles  []string
+		KnownHostsFile string
+	}
+
+	sshConn struct {
+		net.Conn
+		client *ssh.Client
+	}
+)
+
+var (
+	// agents caches the connections to ssh-agent by socket path. They are
+	// reused across connections, and kept open until the process exits,
+	// since signing during handshakes needs them.
+	agents     = map[string]agent.ExtendedAgent{}
+	agentsLock sync.Mutex
+)
+
+func agentClient(socket string) (agent.ExtendedAgent, error) {
+	agentsLock.Lock()
+	defer agentsLock.Unlock()
+	if a, ok := agents[socket]; ok {
+		return a, nil
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	a := agent.NewClient(conn)
+	agents[socket] = a
+	return a, nil
+}
+
+func (c *sshConn) Close() error {
+	err := c.Conn.Close()
+	if e := c.client.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (builder *SSHConnBuilder) jumpAddr() string {
+	port := builder.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(builder.Host, strconv.Itoa(port))
+}
+
+func (builder *SSHConnBuilder) String() string {
+	targetAddr := net.JoinHostPort(builder.TargetHost, strconv.Itoa(builder.TargetPort))
+	return fmt.Sprintf("%s via %s", targetAddr, builder.jumpAddr())
+}
+
+func (builder *SSHConnBuilder) Connect() (net.Conn, error) {
+	jumpAddr := builder.jumpAddr()
+	rawConn, err := dialerOrDefault(builder.Dialer).Dial("tcp", jumpAddr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(rawConn, jumpAddr, builder.Config)
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	targetAddr := net.JoinHostPort(builder.TargetHost, strconv.Itoa(builder.TargetPort))
+	conn, err := client.Dial("tcp", targetAddr)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not connect to %s via %s (%w)", targetAddr, jumpAddr, err)
+	}
+	return &sshConn{conn, client}, nil
+}
+
+func readSigners(identityFiles []string) ([]ssh.Signer, error) {
+	signers := []ssh.Signer{}
+	for _, file := range identityFiles {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			var passphraseErr *ssh.PassphraseMissingError
+			if errors.As(err, &passphraseErr) {
+				// encrypted keys are expected to be available via ssh-agent
+				continue
+			}
+			return nil, fmt.Errorf("could not parse private key %s (%w)", file, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+func NewSSHClientConfig(opts *SSHOpts) (*ssh.ClientConfig, error) {
+	hostKeyCallback, err := knownhosts.New(opts.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known_hosts file (%w)", err)
+	}
+	signers, err := readSigners(opts.IdentityFiles)
+	if err != nil {
+		return nil, err
+	}
+	auths := []ssh.AuthMethod{}
+	var agentErr error
+	if opts.AgentSocket != "" {
+		a, err := agentClient(opts.AgentSocket)
+		if err == nil {
+			auths = append(auths, ssh.PublicKeysCallback(a.Signers))
+		} else {
+			agentErr = fmt.Errorf("could not connect to ssh-agent (%w)", err)
+		}
+	}
+	if len(signers) > 0 {
+		auths = append(auths, ssh.PublicKeys(signers...))
+	}
+	if len(auths) == 0 {
+		if agentErr != nil {
+			return nil, fmt.Errorf("no SSH key available from identity files, and %w", agentErr)
+		}
+		return nil, errors.New("no SSH key available from ssh-agent or identity files")
+	}
+	return &ssh.ClientConfig{
+		User:            opts.User,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
@@ -0,0 +1,263 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func generateKey(t *testing.T) (*ecdsa.PrivateKey, ssh.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, signer
+}
+
+func listen(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+func startEchoServer(t *testing.T) int {
+	listener := listen(t)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// startSSHServer starts an SSH server that only accepts the given client key
+// and only serves direct-tcpip channels (i.e. port forwarding).
+func startSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) int {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener := listen(t)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "direct-tcpip" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		var payload struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChan.ExtraData(), &payload); err != nil {
+			newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			defer ch.Close()
+			defer target.Close()
+			go io.Copy(target, ch)
+			io.Copy(ch, target)
+		}()
+	}
+}
+
+func writeKnownHosts(t *testing.T, dir string, port int, hostKey ssh.PublicKey) string {
+	addr := knownhosts.Normalize(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	return writeFile(t, dir, "known_hosts", []byte(knownhosts.Line([]string{addr}, hostKey)+"\n"))
+}
+
+func startAgent(t *testing.T, dir string, key *ecdsa.PrivateKey) string {
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	return socket
+}
+
+func TestSSHConnBuilder(t *testing.T) {
+	dir := t.TempDir()
+	_, hostKey := generateKey(t)
+	clientKey, clientSigner := generateKey(t)
+	_, otherHostKey := generateKey(t)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := writeFile(t, dir, "id_ecdsa", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	otherKey, _ := generateKey(t)
+	otherKeyDER, _ := x509.MarshalECPrivateKey(otherKey)
+	otherIdentityFile := writeFile(t, dir, "id_other", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherKeyDER}))
+
+	sshPort := startSSHServer(t, hostKey, clientSigner.PublicKey())
+	targetPort := startEchoServer(t)
+	knownHosts := writeKnownHosts(t, dir, sshPort, hostKey.PublicKey())
+	otherKnownHosts := writeKnownHosts(t, t.TempDir(), sshPort, otherHostKey.PublicKey())
+	agentSocket := startAgent(t, dir, clientKey)
+
+	tests := []struct {
+		title string
+		opts  SSHOpts
+		ok    bool
+	}{
+		{
+			"identity file",
+			SSHOpts{IdentityFiles: []string{filepath.Join(dir, "missing"), identityFile}, KnownHostsFile: knownHosts},
+			true,
+		},
+		{
+			"ssh-agent",
+			SSHOpts{AgentSocket: agentSocket, KnownHostsFile: knownHosts},
+			true,
+		},
+		{
+			"unauthorized key",
+			SSHOpts{IdentityFiles: []string{otherIdentityFile}, KnownHostsFile: knownHosts},
+			false,
+		},
+		{
+			"host key mismatch",
+			SSHOpts{IdentityFiles: []string{identityFile}, KnownHostsFile: otherKnownHosts},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			tt.opts.User = "trench"
+			config, err := NewSSHClientConfig(&tt.opts)
+			assert.Nil(t, err)
+			builder := &SSHConnBuilder{
+				Host:       "127.0.0.1",
+				Port:       sshPort,
+				TargetHost: "127.0.0.1",
+				TargetPort: targetPort,
+				Config:     config,
+			}
+			conn, err := builder.Connect()
+			if !tt.ok {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("ping"))
+			assert.Nil(t, err)
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(conn, buf)
+			assert.Nil(t, err)
+			assert.Equal(t, "ping", string(buf))
+		})
+	}
+}
+
+func TestNewSSHClientConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, hostKey := generateKey(t)
+	knownHosts := writeKnownHosts(t, dir, 22, hostKey.PublicKey())
+	notKey := writeFile(t, dir, "not_key", []byte("foo"))
+	tests := []struct {
+		title string
+		opts  SSHOpts
+	}{
+		{"missing known_hosts", SSHOpts{KnownHostsFile: filepath.Join(dir, "missing")}},
+		{"no key available", SSHOpts{KnownHostsFile: knownHosts, IdentityFiles: []string{filepath.Join(dir, "missing")}}},
+		{"malformed key", SSHOpts{KnownHostsFile: knownHosts, IdentityFiles: []string{notKey}}},
+		{"unreachable agent", SSHOpts{KnownHostsFile: knownHosts, AgentSocket: filepath.Join(dir, "missing.sock")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := NewSSHClientConfig(&tt.opts)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestAgentClientIsReused(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := generateKey(t)
+	socket := startAgent(t, dir, key)
+	a1, err := agentClient(socket)
+	assert.Nil(t, err)
+	a2, err := agentClient(socket)
+	assert.Nil(t, err)
+	assert.Same(t, a1, a2)
+
+	_, err = agentClient(filepath.Join(dir, "missing.sock"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+type (
+	TLSConnBuilder struct {
+		Host   string
+		Port   int
+		Config *tls.Config
+		Dialer Dialer
+	}
+
+	TLSOpts struct {
+		CAFile     string
+		CertFile   string
+		KeyFile    string
+		ServerName string
+		Insecure   bool
+	}
+)
+
+func (builder *TLSConnBuilder) String() string {
+	return net.JoinHostPort(builder.Host, strconv.Itoa(builder.Port))
+}
+
+func (builder *TLSConnBuilder) Connect() (net.Conn, error) {
+	addr := net.JoinHostPort(builder.Host, strconv.Itoa(builder.Port))
+	if builder.Dialer == nil {
+		return tls.Dial("tcp", addr, builder.Config)
+	}
+	rawConn, err := builder.Dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{}
+	if builder.Config != nil {
+		config = builder.Config.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = builder.Host
+	}
+	conn := tls.Client(rawConn, config)
+	if err := conn.Handshake(); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func NewTLSConfig(opts *TLSOpts) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.Insecure,
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file (%w)", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file: %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	switch {
+	case opts.CertFile != "" && opts.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate (%w)", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	case opts.CertFile != "" || opts.KeyFile != "":
+		return nil, errors.New("client certificate and key must be specified together")
+	}
+	return config, nil
+}
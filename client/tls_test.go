@@ -0,0 +1,206 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type certKey struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func issueCert(t *testing.T, template *x509.Certificate, parent *certKey) *certKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certKey{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (ck *certKey) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(ck.certPEM, ck.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// startTLSServer starts a TLS server that echoes back a line of input.
+func startTLSServer(t *testing.T, config *tls.Config) int {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 64)
+				n, err := conn.Read(buf)
+				if err != nil {
+					return
+				}
+				conn.Write(buf[:n])
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestTLSConnBuilder(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	server := issueCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "repl.example.com"},
+		DNSNames:     []string{"repl.example.com"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	clientCert := issueCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "trench"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	caFile := writeFile(t, dir, "ca.pem", ca.certPEM)
+	certFile := writeFile(t, dir, "client.pem", clientCert.certPEM)
+	keyFile := writeFile(t, dir, "client-key.pem", clientCert.keyPEM)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	port := startTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate(t)},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+
+	tests := []struct {
+		title string
+		opts  TLSOpts
+		ok    bool
+	}{
+		{
+			"verified with CA and client certificate",
+			TLSOpts{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "repl.example.com"},
+			true,
+		},
+		{
+			"unknown authority",
+			TLSOpts{CertFile: certFile, KeyFile: keyFile, ServerName: "repl.example.com"},
+			false,
+		},
+		{
+			"server name mismatch",
+			TLSOpts{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+			false,
+		},
+		{
+			"no client certificate",
+			TLSOpts{CAFile: caFile, ServerName: "repl.example.com"},
+			false,
+		},
+		{
+			"insecure",
+			TLSOpts{CertFile: certFile, KeyFile: keyFile, Insecure: true},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			config, err := NewTLSConfig(&tt.opts)
+			assert.Nil(t, err)
+			builder := &TLSConnBuilder{Host: "127.0.0.1", Port: port, Config: config}
+			conn, err := builder.Connect()
+			if err == nil {
+				defer conn.Close()
+				_, err = conn.Write([]byte("ping"))
+				if err == nil {
+					buf := make([]byte, 4)
+					_, err = conn.Read(buf)
+				}
+			}
+			if tt.ok {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := writeFile(t, dir, "not.pem", []byte("foo"))
+	tests := []struct {
+		title string
+		opts  TLSOpts
+	}{
+		{"missing CA file", TLSOpts{CAFile: filepath.Join(dir, "missing.pem")}},
+		{"malformed CA file", TLSOpts{CAFile: notPEM}},
+		{"certificate without key", TLSOpts{CertFile: notPEM}},
+		{"malformed key pair", TLSOpts{CertFile: notPEM, KeyFile: notPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := NewTLSConfig(&tt.opts)
+			assert.NotNil(t, err)
+		})
+	}
+}
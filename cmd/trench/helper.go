@@ -3,123 +3,162 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	osuser "os/user"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/athos/trenchman/client"
 	"github.com/athos/trenchman/nrepl"
 	"github.com/athos/trenchman/prepl"
 	"github.com/athos/trenchman/repl"
+	"golang.org/x/crypto/ssh"
 )
 
-var urlRegex = regexp.MustCompile(`^(?:(nrepl|prepl)://)?([^:]+)(?::(\d+))?$`)
+var urlRegex = regexp.MustCompile(`^(?:(nrepls?|prepl)://)?([^:]+)(?::(\d+))?$`)
 var unixUrlRegex = regexp.MustCompile(`^nrepl\+unix:(.+)$`)
+var sshUrlRegex = regexp.MustCompile(`^((?:nrepl|prepl)\+ssh)://(?:([^@/]+)@)?([^/:]+)(?::(\d+))?/([^/:]+)(?::(\d+))?$`)
 
-type setupHelper struct {
-	errHandler client.ErrorHandler
-	debug      bool
-}
+const (
+	TRANSPORT_TCP  = "tcp"
+	TRANSPORT_TLS  = "tls"
+	TRANSPORT_UNIX = "unix"
+	TRANSPORT_SSH  = "ssh"
+)
 
-func readPortFromFile(protocol, portFile string) (int, bool, error) {
-	filename := portFile
-	if portFile == "" {
-		if protocol == "nrepl" {
-			filename = ".nrepl-port"
-		} else {
-			filename = ".prepl-port"
-		}
+type (
+	setupHelper struct {
+		errHandler client.ErrorHandler
+		debug      bool
 	}
-	content, err := os.ReadFile(filename)
-	if err != nil {
-		if portFile == "" {
-			return 0, false, err
-		}
-		return 0, true, err
+
+	serverUrl struct {
+		protocol string
+		dest     string
+		port     int
+		jump     *jumpHost
 	}
-	port, err := strconv.Atoi(string(content))
-	if err != nil {
-		return 0, false, err
+
+	jumpHost struct {
+		user string
+		host string
+		port int
+	}
+)
+
+func portFilePath(protocol, portFile string) string {
+	if portFile != "" {
+		return portFile
 	}
-	return port, false, nil
+	if protocol == "nrepl" {
+		return ".nrepl-port"
+	}
+	return ".prepl-port"
 }
 
-func (h setupHelper) nReplFactory(connBuilder client.ConnBuilder, initNS string) func(client.OutputHandler) client.Client {
-	return func(outHandler client.OutputHandler) client.Client {
+func (h setupHelper) nReplFactory(connBuilder client.ConnBuilder) repl.ClientFactory {
+	return func(opts *repl.ClientOpts) (client.Client, error) {
 		c, err := nrepl.NewClient(&nrepl.Opts{
 			ConnBuilder:   connBuilder,
-			InitNS:        initNS,
-			OutputHandler: outHandler,
-			ErrorHandler:  h.errHandler,
+			InitNS:        opts.InitNS,
+			OutputHandler: opts.OutputHandler,
+			ErrorHandler:  opts.ErrorHandler,
 			Debug:         h.debug,
 		})
 		if err != nil {
-			h.errHandler.HandleErr(err)
+			return nil, &connectionError{err}
 		}
-		return c
+		return c, nil
 	}
 }
 
-func (h setupHelper) pReplFactory(connBuilder client.ConnBuilder, initNS string) func(client.OutputHandler) client.Client {
-	return func(outHandler client.OutputHandler) client.Client {
+func (h setupHelper) pReplFactory(connBuilder client.ConnBuilder) repl.ClientFactory {
+	return func(opts *repl.ClientOpts) (client.Client, error) {
 		c, err := prepl.NewClient(&prepl.Opts{
 			ConnBuilder:   connBuilder,
-			InitNS:        initNS,
-			OutputHandler: outHandler,
-			ErrorHandler:  h.errHandler,
+			InitNS:        opts.InitNS,
+			OutputHandler: opts.OutputHandler,
+			ErrorHandler:  opts.ErrorHandler,
 			Debug:         h.debug,
 		})
 		if err != nil {
-			h.errHandler.HandleErr(err)
+			return nil, &connectionError{err}
 		}
-		return c
+		return c, nil
 	}
 }
 
-func (h setupHelper) setupRepl(protocol string, connBuilder client.ConnBuilder, initNS string, opts *repl.Opts) *repl.Repl {
+func (h setupHelper) clientFactory(protocol string, connBuilder client.ConnBuilder) repl.ClientFactory {
+	if protocol == "nrepl" {
+		return h.nReplFactory(connBuilder)
+	}
+	return h.pReplFactory(connBuilder)
+}
+
+func (h setupHelper) setupRepl(protocol string, connBuilder client.ConnBuilder, opts *repl.Opts) *repl.Repl {
 	opts.In = os.Stdin
 	opts.Out = os.Stdout
 	opts.Err = os.Stderr
 	opts.ErrHandler = h.errHandler
-	var factory func(client.OutputHandler) client.Client
-	if protocol == "nrepl" {
-		factory = h.nReplFactory(connBuilder, initNS)
-	} else {
-		factory = h.pReplFactory(connBuilder, initNS)
-	}
-	return repl.NewRepl(opts, factory)
+	return repl.NewRepl(opts, h.clientFactory(protocol, connBuilder))
 }
 
-func (h setupHelper) parseServerUrl(url string) (protocol string, dest string, port int, err error) {
+func (h setupHelper) parseServerUrl(url string) (*serverUrl, error) {
 	if match := urlRegex.FindStringSubmatch(url); match != nil {
-		protocol = match[1]
-		dest = match[2]
+		ret := &serverUrl{protocol: match[1], dest: match[2]}
 		if match[3] != "" {
-			port, _ = strconv.Atoi(match[3])
+			ret.port, _ = strconv.Atoi(match[3])
 		}
-		return
+		return ret, nil
 	}
 	if match := unixUrlRegex.FindStringSubmatch(url); match != nil {
-		protocol = "nrepl+unix"
-		dest = match[1]
-		return
+		return &serverUrl{protocol: "nrepl+unix", dest: match[1]}, nil
 	}
-	err = errors.New("bad url specified to -s option: " + url)
-	return
+	if match := sshUrlRegex.FindStringSubmatch(url); match != nil {
+		ret := &serverUrl{
+			protocol: match[1],
+			dest:     match[5],
+			jump:     &jumpHost{user: match[2], host: match[3]},
+		}
+		if match[4] != "" {
+			ret.jump.port, _ = strconv.Atoi(match[4])
+		}
+		if match[6] != "" {
+			ret.port, _ = strconv.Atoi(match[6])
+		}
+		return ret, nil
+	}
+	return nil, errors.New("bad url specified to -s option: " + url)
 }
 
-func (h setupHelper) resolveProtocol(protocol string, args *cmdArgs) (ret string, unixSocket bool) {
+func (h setupHelper) resolveProtocol(protocol string, args *cmdArgs) (ret string, transport string) {
 	if protocol == "" {
 		protocol = *args.protocol
 	}
+	transport = TRANSPORT_TCP
+	if *args.tls {
+		transport = TRANSPORT_TLS
+	}
 	switch protocol {
 	case "n", "nrepl":
 		ret = "nrepl"
+	case "nrepls":
+		ret = "nrepl"
+		transport = TRANSPORT_TLS
 	case "nrepl+unix":
 		ret = "nrepl"
-		unixSocket = true
+		transport = TRANSPORT_UNIX
+	case "nrepl+ssh":
+		ret = "nrepl"
+		transport = TRANSPORT_SSH
 	case "p", "prepl":
 		ret = "prepl"
+	case "prepl+ssh":
+		ret = "prepl"
+		transport = TRANSPORT_SSH
 	}
 	return
 }
@@ -129,9 +168,9 @@ func (h setupHelper) resolvePort(protocol string, port int, args *cmdArgs) (int,
 		port = *args.port
 	}
 	if port == 0 {
-		p, portfileSpecified, err := readPortFromFile(protocol, *args.portfile)
+		p, err := client.ReadPortFile(portFilePath(protocol, *args.portfile))
 		if err != nil {
-			if portfileSpecified {
+			if *args.portfile != "" {
 				err = fmt.Errorf("could not read port file: %s", *args.portfile)
 			} else {
 				err = errors.New("port must be specified with -p or -s")
@@ -143,30 +182,173 @@ func (h setupHelper) resolvePort(protocol string, port int, args *cmdArgs) (int,
 	return port, nil
 }
 
+func sshClientConfig(user string, args *cmdArgs) (*ssh.ClientConfig, error) {
+	if user == "" {
+		u, err := osuser.Current()
+		if err != nil {
+			return nil, err
+		}
+		user = u.Username
+	}
+	opts := &client.SSHOpts{
+		User:           user,
+		AgentSocket:    os.Getenv("SSH_AUTH_SOCK"),
+		KnownHostsFile: *args.sshKnownHosts,
+	}
+	if *args.sshIdentity != "" {
+		opts.IdentityFiles = []string{*args.sshIdentity}
+	}
+	if opts.KnownHostsFile == "" || opts.IdentityFiles == nil {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		if opts.KnownHostsFile == "" {
+			opts.KnownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		if opts.IdentityFiles == nil {
+			for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+				opts.IdentityFiles = append(opts.IdentityFiles, filepath.Join(home, ".ssh", name))
+			}
+		}
+	}
+	return client.NewSSHClientConfig(opts)
+}
+
+func proxyDialer(host string, args *cmdArgs) (client.Dialer, error) {
+	var proxyURL *url.URL
+	var err error
+	if *args.proxy != "" {
+		proxyURL, err = url.Parse(*args.proxy)
+	} else {
+		proxyURL, err = client.ProxyURLFromEnvironment(host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return nil, nil
+	}
+	return client.NewProxyDialer(proxyURL)
+}
+
+func (h setupHelper) newConnBuilder(transport string, url *serverUrl, args *cmdArgs) (client.ConnBuilder, error) {
+	if transport == TRANSPORT_UNIX {
+		return &client.UnixConnBuilder{Path: url.dest}, nil
+	}
+	proxyHost := url.dest
+	if transport == TRANSPORT_SSH {
+		proxyHost = url.jump.host
+	}
+	dialer, err := proxyDialer(proxyHost, args)
+	if err != nil {
+		return nil, err
+	}
+	switch transport {
+	case TRANSPORT_TLS:
+		config, err := client.NewTLSConfig(&client.TLSOpts{
+			CAFile:     *args.tlsCA,
+			CertFile:   *args.tlsCert,
+			KeyFile:    *args.tlsKey,
+			ServerName: *args.tlsServerName,
+			Insecure:   *args.tlsInsecure,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &client.TLSConnBuilder{Host: url.dest, Port: url.port, Config: config, Dialer: dialer}, nil
+	case TRANSPORT_SSH:
+		config, err := sshClientConfig(url.jump.user, args)
+		if err != nil {
+			return nil, err
+		}
+		return &client.SSHConnBuilder{
+			Host:       url.jump.host,
+			Port:       url.jump.port,
+			TargetHost: url.dest,
+			TargetPort: url.port,
+			Config:     config,
+			Dialer:     dialer,
+		}, nil
+	default:
+		return &client.TCPConnBuilder{Host: url.dest, Port: url.port, Dialer: dialer}, nil
+	}
+}
+
 func (h setupHelper) resolveConnection(args *cmdArgs) (protocol string, connBuilder client.ConnBuilder) {
-	server := *args.server
-	var dest string
-	var port int
-	if server != "" {
+	url := &serverUrl{}
+	if server := *args.server; server != "" {
 		var err error
-		if protocol, dest, port, err = h.parseServerUrl(server); err != nil {
+		if url, err = h.parseServerUrl(server); err != nil {
 			h.errHandler.HandleErr(err)
 			return
 		}
 	}
-	protocol, unixSocket := h.resolveProtocol(protocol, args)
-	if unixSocket {
-		connBuilder = &client.UnixConnBuilder{Path: dest}
-	} else {
-		port, err := h.resolvePort(protocol, port, args)
-		if err != nil {
+	protocol, transport := h.resolveProtocol(url.protocol, args)
+	if *args.launch != "" {
+		connBuilder = h.launchServer(protocol, transport, url, args)
+		return
+	}
+	if transport != TRANSPORT_UNIX && url.port == 0 && *args.port == 0 && args.retries() {
+		// wait for the port file to be created or updated while retrying
+		connBuilder = &client.PortFileConnBuilder{
+			Path: portFilePath(protocol, *args.portfile),
+			Build: func(port int) (client.ConnBuilder, error) {
+				u := *url
+				u.port = port
+				return h.newConnBuilder(transport, &u, args)
+			},
+		}
+		connBuilder = h.retryConnBuilder(connBuilder, protocol, *args.retryTimeout, args)
+		return
+	}
+	if transport != TRANSPORT_UNIX {
+		var err error
+		if url.port, err = h.resolvePort(protocol, url.port, args); err != nil {
 			h.errHandler.HandleErr(err)
 			return
 		}
-		connBuilder = &client.TCPConnBuilder{Host: dest, Port: port}
 	}
-	if *args.retryTimeout > 0 {
-		connBuilder = client.NewRetryConnBuilder(connBuilder, *args.retryTimeout, *args.retryInterval)
+	connBuilder, err := h.newConnBuilder(transport, url, args)
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return
+	}
+	if args.retries() {
+		connBuilder = h.retryConnBuilder(connBuilder, protocol, *args.retryTimeout, args)
 	}
 	return
 }
+
+func rootCause(err error) error {
+	for {
+		cause := errors.Unwrap(err)
+		if cause == nil {
+			return err
+		}
+		err = cause
+	}
+}
+
+func (h setupHelper) retryConnBuilder(connBuilder client.ConnBuilder, protocol string, timeout time.Duration, args *cmdArgs) client.ConnBuilder {
+	policy := &client.RetryPolicy{
+		Timeout:     timeout,
+		Interval:    *args.retryInterval,
+		MaxInterval: *args.retryMaxInterval,
+		Multiplier:  *args.retryBackoff,
+		Jitter:      *args.retryJitter,
+		MaxAttempts: *args.retryMaxAttempts,
+		DialTimeout: *args.connectTimeout,
+	}
+	if *args.retryProgress {
+		server := "nREPL"
+		if protocol == "prepl" {
+			server = "prepl"
+		}
+		policy.Notify = func(attempt int, err error, wait time.Duration) {
+			dest := client.Describe(connBuilder)
+			fmt.Fprintf(os.Stderr, "Waiting for %s on %s... attempt %d (%s)\n", server, dest, attempt, rootCause(err))
+		}
+	}
+	return client.NewRetryConnBuilderWithPolicy(connBuilder, policy)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/launcher"
+)
+
+const defaultLaunchTimeout = 2 * time.Minute
+
+var exitHooks []func()
+
+func atExit(hook func()) {
+	exitHooks = append(exitHooks, hook)
+}
+
+func runExitHooks() {
+	hooks := exitHooks
+	exitHooks = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+// signalExitCode returns the exit status for the process terminated by
+// the signal, following the shell convention of 128 + the signal number.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return EXIT_INTERRUPTED
+}
+
+// exitOnSignal makes sure that the exit hooks run when the process is
+// terminated by one of the signals, calling onSignal (if non-nil) before
+// exiting. It returns a function to cancel it.
+func exitOnSignal(onSignal func(), sigs ...os.Signal) func() {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig := <-ch:
+			if onSignal != nil {
+				onSignal()
+			}
+			exit(signalExitCode(sig))
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+type launchedConnBuilder struct {
+	client.ConnBuilder
+	server *launcher.Server
+}
+
+func (b *launchedConnBuilder) String() string {
+	return client.Describe(b.ConnBuilder)
+}
+
+func (b *launchedConnBuilder) Connect() (net.Conn, error) {
+	if err := b.server.Err(); err != nil {
+		return nil, err
+	}
+	return b.ConnBuilder.Connect()
+}
+
+func (h setupHelper) reachableConnBuilder(protocol, transport string, url *serverUrl, args *cmdArgs) client.ConnBuilder {
+	u := *url
+	if transport != TRANSPORT_UNIX {
+		port, err := h.resolvePort(protocol, u.port, args)
+		if err != nil {
+			return nil
+		}
+		u.port = port
+	}
+	connBuilder, err := h.newConnBuilder(transport, &u, args)
+	if err != nil || checkReachability(connBuilder, reachabilityTimeout) != nil {
+		return nil
+	}
+	return connBuilder
+}
+
+// launchServer launches a server with the --launch command unless the
+// server is already reachable, and returns the ConnBuilder to connect to it.
+func (h setupHelper) launchServer(protocol, transport string, url *serverUrl, args *cmdArgs) client.ConnBuilder {
+	if connBuilder := h.reachableConnBuilder(protocol, transport, url, args); connBuilder != nil {
+		return connBuilder
+	}
+	u := *url
+	if u.port == 0 {
+		u.port = *args.port
+	}
+	portFile := ""
+	if transport != TRANSPORT_UNIX && u.port == 0 {
+		portFile = portFilePath(protocol, *args.portfile)
+	}
+	server, err := launcher.Start(&launcher.Opts{
+		Command:  *args.launch,
+		LogFile:  *args.launchLog,
+		PortFile: portFile,
+		Daemon:   *args.launchDaemon,
+	})
+	if err != nil {
+		h.errHandler.HandleErr(&connectionError{err})
+		return nil
+	}
+	atExit(func() { server.Stop() })
+	fmt.Fprintf(os.Stderr, "Launched server (pid: %d, log: %s)\n", server.Pid(), server.LogFile())
+	timeout := *args.retryTimeout
+	if timeout == 0 {
+		timeout = defaultLaunchTimeout
+	}
+	if portFile != "" {
+		if u.port, err = server.WaitForPort(timeout); err != nil {
+			h.errHandler.HandleErr(&connectionError{err})
+			return nil
+		}
+	}
+	connBuilder, err := h.newConnBuilder(transport, &u, args)
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return nil
+	}
+	return h.retryConnBuilder(&launchedConnBuilder{connBuilder, server}, protocol, timeout, args)
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/config"
 	"github.com/athos/trenchman/repl"
 	"github.com/fatih/color"
 	"github.com/mattn/go-isatty"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"olympos.io/encoding/edn"
 )
 
 var version = "0.0.0"
@@ -21,27 +27,105 @@ const (
 	COLOR_ALWAYS = "always"
 )
 
+const (
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+)
+
+const (
+	EXIT_RUNTIME_ERROR    = 1
+	EXIT_SYNTAX_ERROR     = 2
+	EXIT_CONNECTION_ERROR = 3
+	EXIT_INTERRUPTED      = 130
+)
+
+const defaultReconnectTimeout = 5 * time.Minute
+
 type cmdArgs struct {
-	port          *int
-	portfile      *string
-	protocol      *string
-	server        *string
-	retryTimeout  *time.Duration
-	retryInterval *time.Duration
-	init          *string
-	eval          *string
-	file          *string
-	mainNS        *string
-	initNS        *string
-	colorOption   *string
-	debug         *bool
-	args          *[]string
+	port             *int
+	portfile         *string
+	protocol         *string
+	server           *string
+	retryTimeout     *time.Duration
+	retryInterval    *time.Duration
+	retryMaxInterval *time.Duration
+	retryBackoff     *float64
+	retryJitter      *float64
+	retryMaxAttempts *int
+	retryProgress    *bool
+	connectTimeout   *time.Duration
+	reconnect        *bool
+	launch           *string
+	launchDaemon     *bool
+	launchLog        *string
+	steps            *[]evalStep
+	keepGoing        *bool
+	stream           *bool
+	script           *string
+	watch            *[]string
+	watchEval        *string
+	watchInterval    *time.Duration
+	reloadPaths      *[]string
+	testTargets      *[]string
+	testVars         *[]string
+	junit            *string
+	replayFile       *string
+	record           *string
+	mainNS           *string
+	initNS           *string
+	colorOption      *string
+	output           *string
+	commandPrefix    *string
+	tls              *bool
+	tlsCA            *string
+	tlsCert          *string
+	tlsKey           *string
+	tlsServerName    *string
+	tlsInsecure      *bool
+	sshIdentity      *string
+	sshKnownHosts    *string
+	proxy            *string
+	debug            *bool
+	profile          *string
+	alias            *string
+	args             *[]string
+	// given is the set of flags given on the command line or via
+	// environment variables
+	given map[string]bool
 }
 
 type errorHandler struct {
 	printer repl.Printer
 }
 
+// connectionError represents errors that occurred while connecting to
+// the server.
+type connectionError struct {
+	err error
+}
+
+func (e *connectionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connectionError) Unwrap() error {
+	return e.err
+}
+
+func exitCode(err error) int {
+	var connErr *connectionError
+	var rtErr *client.RuntimeError
+	switch {
+	case errors.As(err, &connErr) || client.IsDisconnected(err):
+		return EXIT_CONNECTION_ERROR
+	case errors.As(err, &rtErr):
+		if details := rtErr.Details(); details != nil && details.IsSyntaxError() {
+			return EXIT_SYNTAX_ERROR
+		}
+	}
+	return EXIT_RUNTIME_ERROR
+}
+
 func (h errorHandler) HandleErr(err error) {
 	var errmsg string
 	switch err {
@@ -51,24 +135,226 @@ func (h errorHandler) HandleErr(err error) {
 		errmsg = err.Error()
 	}
 	h.printer.With(color.FgRed).Fprintln(os.Stderr, errmsg)
-	os.Exit(1)
-}
-
-var args = cmdArgs{
-	port:          kingpin.Flag("port", "Connect to the specified port.").Short('p').Int(),
-	portfile:      kingpin.Flag("port-file", "Specify port file that specifies port to connect to. Defaults to .nrepl-port.").PlaceHolder("FILE").String(),
-	protocol:      kingpin.Flag("protocol", "Use the specified protocol. Possible values: n[repl], p[repl]. Defaults to nrepl.").Default("nrepl").Short('P').Enum("n", "nrepl", "p", "prepl"),
-	server:        kingpin.Flag("server", "Connect to the specified URL (e.g. prepl://127.0.0.1:5555, nrepl+unix:/foo/bar.socket).").Default("127.0.0.1").Short('s').PlaceHolder("[(nrepl|prepl)://]host[:port]|nrepl+unix:/path").String(),
-	retryTimeout:  kingpin.Flag("retry-timeout", "Timeout after which retries are aborted. By default, Trenchman never retries connection.").PlaceHolder("DURATION").Duration(),
-	retryInterval: kingpin.Flag("retry-interval", "Interval between retries when connecting to the server.").Default("1s").Duration(),
-	init:          kingpin.Flag("init", "Load a file before execution.").Short('i').PlaceHolder("FILE").String(),
-	eval:          kingpin.Flag("eval", "Evaluate an expression.").Short('e').PlaceHolder("EXPR").String(),
-	file:          kingpin.Flag("file", "Evaluate a file.").Short('f').String(),
-	mainNS:        kingpin.Flag("main", "Call the -main function for a namespace.").Short('m').PlaceHolder("NAMESPACE").String(),
-	initNS:        kingpin.Flag("init-ns", "Initialize REPL with the specified namespace. Defaults to \"user\".").PlaceHolder("NAMESPACE").String(),
-	colorOption:   kingpin.Flag("color", "When to use colors. Possible values: always, auto, none. Defaults to auto.").Default(COLOR_AUTO).Short('C').Enum(COLOR_NONE, COLOR_AUTO, COLOR_ALWAYS),
-	debug:         kingpin.Flag("debug", "Print debug information.").Bool(),
-	args:          kingpin.Arg("args", "Arguments to pass to -main. These will be ignored unless -m is specified.").Strings(),
+	exit(exitCode(err))
+}
+
+// commands are the subcommands of trench.
+type commands struct {
+	repl    *kingpin.CmdClause
+	connect *kingpin.CmdClause
+	list    *kingpin.CmdClause
+	reload  *kingpin.CmdClause
+	test    *kingpin.CmdClause
+	replay  *kingpin.CmdClause
+}
+
+func newCommands(app *kingpin.Application) *commands {
+	return &commands{
+		repl:    app.Command("repl", "Start a REPL session or evaluate code (default).").Default(),
+		connect: app.Command("connect", "Connect to the server registered with the specified alias."),
+		list:    app.Command("list", "List registered connection aliases along with their reachability."),
+		reload:  app.Command("reload", "Reload changed namespaces in dependency order via clojure.tools.namespace, or load the files under the specified paths."),
+		test:    app.Command("test", "Run clojure.test tests in the specified namespaces, source files or directories (defaults to ./test)."),
+		replay:  app.Command("replay", "Evaluate the inputs recorded with --record again, and report the results that differ from the recorded ones."),
+	}
+}
+
+func mainArgs(cmds ...*kingpin.CmdClause) *[]string {
+	ret := &[]string{}
+	for _, cmd := range cmds {
+		cmd.Arg("args", "Arguments to pass to -main or the --script file. These will be ignored unless -m or --script is specified.").StringsVar(ret)
+	}
+	return ret
+}
+
+// newCmdArgs defines the options and arguments of the commands in the app.
+func newCmdArgs(app *kingpin.Application, cmds *commands) cmdArgs {
+	return cmdArgs{
+		port:             app.Flag("port", "Connect to the specified port.").Short('p').Envar("TRENCHMAN_PORT").Int(),
+		portfile:         app.Flag("port-file", "Specify port file that specifies port to connect to. Defaults to .nrepl-port.").Envar("TRENCHMAN_PORT_FILE").PlaceHolder("FILE").String(),
+		protocol:         app.Flag("protocol", "Use the specified protocol. Possible values: n[repl], p[repl]. Defaults to nrepl.").Short('P').Envar("TRENCHMAN_PROTOCOL").PlaceHolder("nrepl").Enum("n", "nrepl", "p", "prepl"),
+		server:           app.Flag("server", "Connect to the specified URL (e.g. prepl://127.0.0.1:5555, nrepls://127.0.0.1:7888, nrepl+unix:/foo/bar.socket, nrepl+ssh://user@bastion/127.0.0.1:7888). Defaults to 127.0.0.1.").Short('s').Envar("TRENCHMAN_SERVER").PlaceHolder("[(nrepl|nrepls|prepl)://]host[:port]|nrepl+unix:/path|(nrepl|prepl)+ssh://[user@]host[:port]/host[:port]").String(),
+		retryTimeout:     app.Flag("retry-timeout", "Timeout after which retries are aborted. By default, Trenchman never retries connection.").Envar("TRENCHMAN_RETRY_TIMEOUT").PlaceHolder("DURATION").Duration(),
+		retryInterval:    app.Flag("retry-interval", "Interval between retries when connecting to the server (at least 10ms). Defaults to 1s.").Envar("TRENCHMAN_RETRY_INTERVAL").PlaceHolder("1s").Duration(),
+		retryMaxInterval: app.Flag("retry-max-interval", "Upper limit of the interval between retries.").Envar("TRENCHMAN_RETRY_MAX_INTERVAL").PlaceHolder("DURATION").Duration(),
+		retryBackoff:     app.Flag("retry-backoff", "Factor by which the interval between retries is multiplied after each retry. Defaults to 1 (constant interval).").Envar("TRENCHMAN_RETRY_BACKOFF").PlaceHolder("1.0").Float64(),
+		retryJitter:      app.Flag("retry-jitter", "Randomize the interval between retries by the given fraction (0 to 1).").Envar("TRENCHMAN_RETRY_JITTER").PlaceHolder("0.0").Float64(),
+		retryMaxAttempts: app.Flag("retry-max-attempts", "Maximum number of connection attempts. By default, the number of attempts is only limited by --retry-timeout.").Envar("TRENCHMAN_RETRY_MAX_ATTEMPTS").PlaceHolder("N").Int(),
+		retryProgress:    app.Flag("retry-progress", "Print progress while retrying connection.").Envar("TRENCHMAN_RETRY_PROGRESS").Bool(),
+		connectTimeout:   app.Flag("connect-timeout", "Timeout for each connection attempt.").Envar("TRENCHMAN_CONNECT_TIMEOUT").PlaceHolder("DURATION").Duration(),
+		reconnect:        app.Flag("reconnect", "Reconnect to the server when disconnected, instead of exiting. Retries until --retry-timeout (defaults to 5m) elapses.").Envar("TRENCHMAN_RECONNECT").Bool(),
+		launch:           app.Flag("launch", "Launch a server with the specified shell command if no server is reachable (e.g. \"clojure -M:nrepl\").").Envar("TRENCHMAN_LAUNCH").PlaceHolder("COMMAND").String(),
+		launchDaemon:     app.Flag("launch-daemon", "Leave the launched server running after exit.").Envar("TRENCHMAN_LAUNCH_DAEMON").Bool(),
+		launchLog:        app.Flag("launch-log", "File to write the output of the launched server to. Defaults to a temporary file.").Envar("TRENCHMAN_LAUNCH_LOG").PlaceHolder("FILE").String(),
+		steps:            evalSteps(app),
+		stream:           app.Flag("stream", "With -f -, evaluate each form read from stdin as soon as it is complete, instead of after reading all input.").Envar("TRENCHMAN_STREAM").Bool(),
+		keepGoing:        app.Flag("keep-going", "Continue evaluating the rest of -i, -e and -f options after a failure.").Envar("TRENCHMAN_KEEP_GOING").Bool(),
+		script:           app.Flag("script", "Load a script file with the rest of the arguments bound to *command-line-args*. Suitable for shebang lines.").PlaceHolder("FILE").String(),
+		watch:            app.Flag("watch", "Watch a file or directory, and reload changed files along with the ones depending on them. Can be repeated.").Envar("TRENCHMAN_WATCH").PlaceHolder("PATH").Strings(),
+		watchEval:        app.Flag("watch-eval", "Evaluate an expression after each successful reload in the --watch mode (e.g. to run tests).").Envar("TRENCHMAN_WATCH_EVAL").PlaceHolder("EXPR").String(),
+		watchInterval:    app.Flag("watch-interval", "Interval between checks for changes in the --watch mode. Defaults to 500ms.").Envar("TRENCHMAN_WATCH_INTERVAL").PlaceHolder("500ms").Duration(),
+		reloadPaths:      cmds.reload.Arg("paths", "Files or directories to load in dependency order, instead of refreshing with clojure.tools.namespace.").Strings(),
+		testTargets:      cmds.test.Arg("targets", "Namespaces to test, source files, or directories to discover *-test namespaces from.").Strings(),
+		testVars:         cmds.test.Flag("var", "Run only the specified test var (e.g. foo.core-test/bar-test or bar-test). Can be repeated.").PlaceHolder("VAR").Strings(),
+		junit:            cmds.test.Flag("junit", "Write the test results to a file in the JUnit XML format.").PlaceHolder("FILE").String(),
+		replayFile:       cmds.replay.Arg("file", "Transcript file recorded with --record.").Required().String(),
+		record:           app.Flag("record", "Record the inputs, outputs, results and exceptions with timestamps to a file as newline-delimited JSON events.").PlaceHolder("FILE").String(),
+		mainNS:           app.Flag("main", "Call the -main function for a namespace.").Short('m').PlaceHolder("NAMESPACE").String(),
+		initNS:           app.Flag("init-ns", "Initialize REPL with the specified namespace. Defaults to \"user\".").Envar("TRENCHMAN_INIT_NS").PlaceHolder("NAMESPACE").String(),
+		colorOption:      app.Flag("color", "When to use colors. Possible values: always, auto, none. Defaults to auto.").Short('C').Envar("TRENCHMAN_COLOR").PlaceHolder(COLOR_AUTO).Enum(COLOR_NONE, COLOR_AUTO, COLOR_ALWAYS),
+		output:           app.Flag("output", "Output format. Possible values: text, json. json emits results and outputs as newline-delimited JSON events.").Short('o').Envar("TRENCHMAN_OUTPUT").PlaceHolder(OUTPUT_TEXT).Enum(OUTPUT_TEXT, OUTPUT_JSON),
+		commandPrefix:    app.Flag("command-prefix", "Prefix of REPL commands (e.g. ,help). Defaults to \",\".").Envar("TRENCHMAN_COMMAND_PREFIX").PlaceHolder(",").String(),
+		tls:              app.Flag("tls", "Connect to the server via TLS. Implied by the nrepls:// scheme.").Envar("TRENCHMAN_TLS").Bool(),
+		tlsCA:            app.Flag("tls-ca", "CA certificate bundle (PEM) to verify the server certificate with.").Envar("TRENCHMAN_TLS_CA").PlaceHolder("FILE").String(),
+		tlsCert:          app.Flag("tls-cert", "Client certificate (PEM) for TLS connections.").Envar("TRENCHMAN_TLS_CERT").PlaceHolder("FILE").String(),
+		tlsKey:           app.Flag("tls-key", "Private key (PEM) of the client certificate.").Envar("TRENCHMAN_TLS_KEY").PlaceHolder("FILE").String(),
+		tlsServerName:    app.Flag("tls-server-name", "Server name to verify the server certificate against. Defaults to the server host.").Envar("TRENCHMAN_TLS_SERVER_NAME").PlaceHolder("NAME").String(),
+		tlsInsecure:      app.Flag("tls-insecure", "Skip verification of the server certificate (insecure).").Envar("TRENCHMAN_TLS_INSECURE").Bool(),
+		sshIdentity:      app.Flag("ssh-identity", "Private key file for SSH connections. Defaults to ~/.ssh/id_{ed25519,ecdsa,rsa}.").Envar("TRENCHMAN_SSH_IDENTITY").PlaceHolder("FILE").String(),
+		sshKnownHosts:    app.Flag("ssh-known-hosts", "known_hosts file to verify SSH host keys with. Defaults to ~/.ssh/known_hosts.").Envar("TRENCHMAN_SSH_KNOWN_HOSTS").PlaceHolder("FILE").String(),
+		proxy:            app.Flag("proxy", "Connect via the specified proxy (e.g. socks5://127.0.0.1:1080, http://proxy:3128). Defaults to $ALL_PROXY or $HTTPS_PROXY.").Envar("TRENCHMAN_PROXY").PlaceHolder("URL").String(),
+		debug:            app.Flag("debug", "Print debug information.").Envar("TRENCHMAN_DEBUG").Bool(),
+		profile:          app.Flag("profile", "Use the specified profile in config files.").Envar("TRENCHMAN_PROFILE").PlaceHolder("NAME").String(),
+		alias:            cmds.connect.Arg("alias", "Alias of the connection to connect to.").Required().HintAction(connectionAliases).String(),
+		args:             mainArgs(cmds.repl, cmds.connect),
+	}
+}
+
+var (
+	cmds = newCommands(kingpin.CommandLine)
+	args = newCmdArgs(kingpin.CommandLine, cmds)
+)
+
+// loadSettings loads the settings of the connection alias, if any, falling
+// back to the ones in the config files. Options given on the command line
+// or via environment variables take precedence over them.
+func (args *cmdArgs) loadSettings() (*config.Settings, error) {
+	settings := &config.Settings{}
+	if *args.alias != "" {
+		conns, err := config.LoadConnections()
+		if err != nil {
+			return nil, err
+		}
+		conn, ok := conns[*args.alias]
+		if !ok {
+			return nil, fmt.Errorf("unknown connection alias: %s", *args.alias)
+		}
+		settings.Merge(conn.Settings())
+	}
+	files, err := config.Load(*args.profile)
+	if err != nil {
+		return nil, err
+	}
+	settings.Merge(files)
+	return settings, nil
+}
+
+// givenFlags returns the names of the flags given on the command line or
+// via environment variables, which take precedence over the settings.
+func givenFlags(app *kingpin.Application, argv []string) map[string]bool {
+	ret := map[string]bool{}
+	for _, flag := range app.Model().Flags {
+		if flag.Envar != "" && os.Getenv(flag.Envar) != "" {
+			ret[flag.Name] = true
+		}
+	}
+	context, err := app.ParseContext(argv)
+	if err != nil {
+		return ret
+	}
+	for _, element := range context.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok {
+			ret[flag.Model().Name] = true
+		}
+	}
+	return ret
+}
+
+func (args *cmdArgs) applySettings(s *config.Settings) {
+	setString := func(name string, arg *string, setting *string, defaultValue string) {
+		if args.given[name] {
+			return
+		}
+		if setting != nil {
+			*arg = *setting
+		} else if *arg == "" {
+			*arg = defaultValue
+		}
+	}
+	setBool := func(name string, arg *bool, setting *bool) {
+		if !args.given[name] && setting != nil {
+			*arg = *setting
+		}
+	}
+	setInt := func(name string, arg *int, setting *int) {
+		if !args.given[name] && setting != nil {
+			*arg = *setting
+		}
+	}
+	setFloat := func(name string, arg *float64, setting *float64) {
+		if !args.given[name] && setting != nil {
+			*arg = *setting
+		}
+	}
+	setDuration := func(name string, arg *time.Duration, setting *config.Duration, defaultValue time.Duration) {
+		if args.given[name] {
+			return
+		}
+		if setting != nil {
+			*arg = setting.Duration
+		} else if *arg == 0 {
+			*arg = defaultValue
+		}
+	}
+	setStrings := func(name string, arg *[]string, setting []string) {
+		if !args.given[name] && setting != nil {
+			*arg = setting
+		}
+	}
+	setInt("port", args.port, s.Port)
+	setString("port-file", args.portfile, s.PortFile, "")
+	setString("protocol", args.protocol, s.Protocol, "nrepl")
+	setString("server", args.server, s.Server, "127.0.0.1")
+	setDuration("retry-timeout", args.retryTimeout, s.RetryTimeout, 0)
+	setDuration("retry-interval", args.retryInterval, s.RetryInterval, time.Second)
+	setDuration("retry-max-interval", args.retryMaxInterval, s.RetryMaxInterval, 0)
+	setFloat("retry-backoff", args.retryBackoff, s.RetryBackoff)
+	setFloat("retry-jitter", args.retryJitter, s.RetryJitter)
+	setInt("retry-max-attempts", args.retryMaxAttempts, s.RetryMaxAttempts)
+	setBool("retry-progress", args.retryProgress, s.RetryProgress)
+	setDuration("connect-timeout", args.connectTimeout, s.ConnectTimeout, 0)
+	setBool("reconnect", args.reconnect, s.Reconnect)
+	setString("launch", args.launch, s.Launch, "")
+	setBool("launch-daemon", args.launchDaemon, s.LaunchDaemon)
+	setString("launch-log", args.launchLog, s.LaunchLog, "")
+	args.applyStepSettings(s)
+	setBool("keep-going", args.keepGoing, s.KeepGoing)
+	setBool("stream", args.stream, s.Stream)
+	setStrings("watch", args.watch, s.Watch)
+	setString("watch-eval", args.watchEval, s.WatchEval, "")
+	setDuration("watch-interval", args.watchInterval, s.WatchInterval, defaultWatchInterval)
+	setString("main", args.mainNS, s.Main, "")
+	setString("init-ns", args.initNS, s.InitNS, "")
+	setString("color", args.colorOption, s.Color, COLOR_AUTO)
+	setString("output", args.output, s.Output, OUTPUT_TEXT)
+	setString("command-prefix", args.commandPrefix, s.CommandPrefix, repl.DefaultCommandPrefix)
+	setBool("tls", args.tls, s.TLS)
+	setString("tls-ca", args.tlsCA, s.TLSCA, "")
+	setString("tls-cert", args.tlsCert, s.TLSCert, "")
+	setString("tls-key", args.tlsKey, s.TLSKey, "")
+	setString("tls-server-name", args.tlsServerName, s.TLSServerName, "")
+	setBool("tls-insecure", args.tlsInsecure, s.TLSInsecure)
+	setString("ssh-identity", args.sshIdentity, s.SSHIdentity, "")
+	setString("ssh-known-hosts", args.sshKnownHosts, s.SSHKnownHosts, "")
+	setString("proxy", args.proxy, s.Proxy, "")
+	setBool("debug", args.debug, s.Debug)
+	if len(*args.args) == 0 && s.Args != nil {
+		*args.args = s.Args
+	}
+}
+
+func (args *cmdArgs) retries() bool {
+	return *args.retryTimeout > 0 || *args.retryMaxAttempts > 0
 }
 
 func colorized(colorOption string) bool {
@@ -86,52 +372,183 @@ func colorized(colorOption string) bool {
 	return false
 }
 
+// buildMainInvocation builds the code to call -main, which returns the exit
+// code if -main returns an integer or throws an ex-info with :exit-code.
 func buildMainInvocation(mainNS string, args []string) string {
 	quotedArgs := []string{}
 	for _, arg := range args {
 		quotedArgs = append(quotedArgs, fmt.Sprintf("%q", arg))
 	}
 	argStr := strings.Join(quotedArgs, " ")
-	return fmt.Sprintf("(do (require '%s) (%s/-main %s) nil)", mainNS, mainNS, argStr)
+	return fmt.Sprintf(
+		"(do (require '%s) "+
+			"(let [ret (try (%s/-main %s) "+
+			"(catch clojure.lang.ExceptionInfo e "+
+			"(if-let [code (:exit-code (ex-data e))] "+
+			"(do (when-let [msg (.getMessage e)] (binding [*out* *err*] (println msg))) code) "+
+			"(throw e))))] "+
+			"(when (integer? ret) ret)))",
+		mainNS, mainNS, argStr,
+	)
+}
+
+// mainExitStatus returns the exit status requested by -main, which is the
+// value of the invocation built by buildMainInvocation if it's an integer.
+func mainExitStatus(value string) (int, bool) {
+	status, err := strconv.Atoi(value)
+	return status, err == nil
+}
+
+// userCommands creates the REPL commands defined in the config files,
+// sorted by name.
+func userCommands(cmds config.Commands) []*repl.Command {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	ret := make([]*repl.Command, len(names))
+	for i, name := range names {
+		cmd := cmds[edn.Keyword(name)]
+		ret[i] = repl.TemplateCommand(name, cmd.Code, cmd.Help)
+	}
+	return ret
 }
 
 func main() {
 	kingpin.Version("Trenchman " + version)
-	kingpin.Parse()
+	argv := normalizeArgs(os.Args[1:])
+	cmd := kingpin.MustParse(kingpin.CommandLine.Parse(argv))
+	args.given = givenFlags(kingpin.CommandLine, argv)
+
+	settings, err := args.loadSettings()
+	if err != nil {
+		errorHandler{repl.NewPrinter(false)}.HandleErr(err)
+	}
+	args.applySettings(settings)
 
 	printer := repl.NewPrinter(colorized(*args.colorOption))
 	errHandler := errorHandler{printer}
 	helper := setupHelper{errHandler, *args.debug}
+	if cmd == cmds.list.FullCommand() {
+		helper.listConnections(printer, &args)
+		return
+	}
+	defer runExitHooks()
+	stopExitOnSignal := exitOnSignal(nil, os.Interrupt, syscall.SIGTERM)
 	protocol, connBuilder := helper.resolveConnection(&args)
-	initFile := strings.TrimSpace(*args.init)
-	filename := strings.TrimSpace(*args.file)
 	initNS := strings.TrimSpace(*args.initNS)
 	mainNS := strings.TrimSpace(*args.mainNS)
-	code := strings.TrimSpace(*args.eval)
+	script := strings.TrimSpace(*args.script)
+	watching := len(*args.watch) > 0
+	reloading := cmd == cmds.reload.FullCommand()
+	testing := cmd == cmds.test.FullCommand()
+	replaying := cmd == cmds.replay.FullCommand()
+	nonInteractive := args.hasStep(STEP_EVAL, STEP_FILE) || script != "" || mainNS != "" || reloading || testing || replaying || watching
 	opts := &repl.Opts{
-		Printer:  printer,
-		HidesNil: filename != "" || mainNS != "" || code != "",
+		Printer:       printer,
+		HidesNil:      nonInteractive,
+		InitNS:        initNS,
+		JSON:          *args.output == OUTPUT_JSON,
+		CommandPrefix: *args.commandPrefix,
+		Commands:      userCommands(settings.Commands),
+		// the exit status and the --watch summary depend on the phase
+		// of errors
+		TriagesErrors: nonInteractive,
+	}
+	if *args.record != "" {
+		f, err := os.Create(*args.record)
+		if err != nil {
+			errHandler.HandleErr(err)
+		}
+		defer f.Close()
+		opts.Record = f
 	}
-	repl := helper.setupRepl(protocol, connBuilder, initNS, opts)
+	if *args.reconnect {
+		reconnectBuilder := connBuilder
+		if !args.retries() {
+			reconnectBuilder = helper.retryConnBuilder(connBuilder, protocol, defaultReconnectTimeout, &args)
+		}
+		opts.Reconnect = helper.clientFactory(protocol, reconnectBuilder)
+	}
+	repl := helper.setupRepl(protocol, connBuilder, opts)
 	defer repl.Close()
+	stopExitOnSignal()
 
-	if initFile != "" {
-		repl.LoadWithResultVisibility(initFile, true)
-	}
-	if filename != "" {
-		repl.Load(filename)
+	if !nonInteractive {
+		for _, step := range *args.steps {
+			repl.LoadInit(step.arg)
+		}
+		// SIGINT is used to interrupt evaluation in the REPL
+		exitOnSignal(nil, syscall.SIGTERM)
+		if repl.SupportsOp("interrupt") {
+			repl.StartWatchingInterruption()
+		}
+		repl.Start()
 		return
 	}
+
+	exitOnSignal(func() {
+		if repl.SupportsOp("interrupt") {
+			repl.Interrupt()
+		}
+	}, os.Interrupt, syscall.SIGTERM)
+	// with --keep-going, exit with the status for the first failure
+	// after evaluating everything. Failures don't stop the --watch mode.
+	var firstErr error
+	handleErr := func(err error) {
+		if err == nil {
+			return
+		}
+		if !*args.keepGoing && !watching {
+			exit(exitCode(err))
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, step := range *args.steps {
+		switch step.kind {
+		case STEP_INIT:
+			handleErr(repl.LoadInit(step.arg))
+		case STEP_FILE:
+			if step.arg == "-" && *args.stream {
+				handleErr(repl.EvalStream(*args.keepGoing))
+			} else {
+				handleErr(repl.Load(step.arg))
+			}
+		case STEP_EVAL:
+			handleErr(repl.Eval(step.arg))
+		}
+	}
+	if script != "" {
+		handleErr(repl.LoadScript(script, *args.args))
+	}
 	if mainNS != "" {
-		repl.Eval(buildMainInvocation(mainNS, *args.args))
-		return
+		value, err := repl.EvalForValue(buildMainInvocation(mainNS, *args.args))
+		handleErr(err)
+		if status, ok := mainExitStatus(value); ok && firstErr == nil && !watching {
+			exit(status)
+		}
+	}
+	if reloading {
+		if len(*args.reloadPaths) > 0 {
+			handleErr(repl.ReloadFiles(*args.reloadPaths))
+		} else {
+			handleErr(repl.Reload())
+		}
+	}
+	if testing {
+		handleErr(helper.runTests(repl, printer, &args))
+	}
+	if replaying {
+		handleErr(helper.replay(repl, printer, &args))
 	}
-	if code != "" {
-		repl.Eval(code)
+	if watching {
+		helper.watch(repl, printer, &args)
 		return
 	}
-	if repl.SupportsOp("interrupt") {
-		repl.StartWatchingInterruption()
+	if firstErr != nil {
+		exit(exitCode(firstErr))
 	}
-	repl.Start()
 }
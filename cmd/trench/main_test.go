@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/config"
+	"github.com/athos/trenchman/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{errors.New("boom"), EXIT_RUNTIME_ERROR},
+		{client.NewRuntimeError("Divide by zero"), EXIT_RUNTIME_ERROR},
+		{client.NewRuntimeErrorWithDetails("Divide by zero", &client.ErrorDetails{Phase: "execution"}), EXIT_RUNTIME_ERROR},
+		{client.NewRuntimeErrorWithDetails("EOF while reading", &client.ErrorDetails{Phase: "read-source"}), EXIT_SYNTAX_ERROR},
+		{client.NewRuntimeErrorWithDetails("Unable to resolve symbol", &client.ErrorDetails{Phase: "compile-syntax-check"}), EXIT_SYNTAX_ERROR},
+		{client.NewRuntimeErrorWithDetails("Unmatched delimiter", &client.ErrorDetails{Class: "clojure.lang.LispReader$ReaderException"}), EXIT_SYNTAX_ERROR},
+		{fmt.Errorf("load failed (%w)", client.NewRuntimeErrorWithDetails("EOF", &client.ErrorDetails{Phase: "read-source"})), EXIT_SYNTAX_ERROR},
+		{&connectionError{errors.New("connection refused")}, EXIT_CONNECTION_ERROR},
+		{fmt.Errorf("launch failed (%w)", &connectionError{errors.New("no port")}), EXIT_CONNECTION_ERROR},
+		{client.ErrDisconnected, EXIT_CONNECTION_ERROR},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, exitCode(tt.err), tt.err.Error())
+	}
+}
+
+func TestSignalExitCode(t *testing.T) {
+	assert.Equal(t, EXIT_INTERRUPTED, signalExitCode(os.Interrupt))
+	assert.Equal(t, 143, signalExitCode(syscall.SIGTERM))
+}
+
+func TestBuildMainInvocation(t *testing.T) {
+	assert.Equal(t,
+		"(do (require 'foo.core) "+
+			"(let [ret (try (foo.core/-main \"a b\" \"\\\"c\\\"\") "+
+			"(catch clojure.lang.ExceptionInfo e "+
+			"(if-let [code (:exit-code (ex-data e))] "+
+			"(do (when-let [msg (.getMessage e)] (binding [*out* *err*] (println msg))) code) "+
+			"(throw e))))] "+
+			"(when (integer? ret) ret)))",
+		buildMainInvocation("foo.core", []string{"a b", `"c"`}))
+	assert.Contains(t, buildMainInvocation("foo.core", nil), "(foo.core/-main )")
+}
+
+func TestMainExitStatus(t *testing.T) {
+	tests := []struct {
+		value  string
+		status int
+		ok     bool
+	}{
+		{"nil", 0, false},
+		{"0", 0, true},
+		{"42", 42, true},
+		{":done", 0, false},
+		{"\"1\"", 0, false},
+	}
+	for _, tt := range tests {
+		status, ok := mainExitStatus(tt.value)
+		assert.Equal(t, tt.ok, ok, tt.value)
+		assert.Equal(t, tt.status, status, tt.value)
+	}
+}
+
+// parseArgs parses the arguments with a fresh app as main does, and
+// applies the settings in the config files to them.
+func parseArgs(t *testing.T, argv []string) *cmdArgs {
+	t.Helper()
+	app := kingpin.New("trench", "")
+	args := newCmdArgs(app, newCommands(app))
+	argv = normalizeArgs(argv)
+	if _, err := app.Parse(argv); err != nil {
+		t.Fatal(err)
+	}
+	args.given = givenFlags(app, argv)
+	settings, err := args.loadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.applySettings(settings)
+	return &args
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	testutil.WriteFile(t, filepath.Join(project, config.ProjectFile), `
+{:server "project:1111"
+ :init-ns "project"
+ :retry-interval "3s"
+ :connections {:dev {:server "alias:2222" :init-ns "alias"}}}`)
+	testutil.WriteFile(t, filepath.Join(dir, "xdg", config.UserFile), `
+{:server "user:3333"
+ :init-ns "user"
+ :output "json"
+ :debug true}`)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		title         string
+		argv          []string
+		env           map[string]string
+		server        string
+		initNS        string
+		output        string
+		debug         bool
+		retryInterval time.Duration
+		protocol      string
+	}{
+		{
+			"project config over user config",
+			[]string{},
+			nil,
+			"project:1111", "project", "json", true, 3 * time.Second, "nrepl",
+		},
+		{
+			"flag over config",
+			[]string{"-s", "flag:4444", "--retry-interval", "5s", "--no-debug"},
+			nil,
+			"flag:4444", "project", "json", false, 5 * time.Second, "nrepl",
+		},
+		{
+			"env var over config",
+			[]string{},
+			map[string]string{"TRENCHMAN_SERVER": "env:5555", "TRENCHMAN_OUTPUT": "text", "TRENCHMAN_DEBUG": "false"},
+			"env:5555", "project", "text", false, 3 * time.Second, "nrepl",
+		},
+		{
+			"flag over env var",
+			[]string{"--server=flag:4444"},
+			map[string]string{"TRENCHMAN_SERVER": "env:5555"},
+			"flag:4444", "project", "json", true, 3 * time.Second, "nrepl",
+		},
+		{
+			"alias over config",
+			[]string{"connect", "dev"},
+			nil,
+			"alias:2222", "alias", "json", true, 3 * time.Second, "nrepl",
+		},
+		{
+			"flag and env var over alias",
+			[]string{"connect", "dev", "--init-ns", "flag"},
+			map[string]string{"TRENCHMAN_SERVER": "env:5555"},
+			"env:5555", "flag", "json", true, 3 * time.Second, "nrepl",
+		},
+		{
+			"empty env var not counted as given",
+			[]string{"-P", "prepl"},
+			map[string]string{"TRENCHMAN_INIT_NS": ""},
+			"project:1111", "project", "json", true, 3 * time.Second, "prepl",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := parseArgs(t, tt.argv)
+			assert.Equal(t, tt.server, *args.server)
+			assert.Equal(t, tt.initNS, *args.initNS)
+			assert.Equal(t, tt.output, *args.output)
+			assert.Equal(t, tt.debug, *args.debug)
+			assert.Equal(t, tt.retryInterval, *args.retryInterval)
+			assert.Equal(t, tt.protocol, *args.protocol)
+		})
+	}
+
+	// the defaults apply only when none of flags, env vars and config
+	// files specify the options
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "none"))
+	args := parseArgs(t, []string{})
+	assert.Equal(t, "127.0.0.1", *args.server)
+	assert.Equal(t, time.Second, *args.retryInterval)
+	assert.Equal(t, OUTPUT_TEXT, *args.output)
+	assert.Equal(t, "nrepl", *args.protocol)
+}
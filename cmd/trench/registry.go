@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/config"
+	"github.com/athos/trenchman/repl"
+	"github.com/fatih/color"
+)
+
+const reachabilityTimeout = 2 * time.Second
+
+func connectionAliases() []string {
+	conns, err := config.LoadConnections()
+	if err != nil {
+		return nil
+	}
+	return sortedAliases(conns)
+}
+
+func sortedAliases(conns map[string]config.Connection) []string {
+	aliases := []string{}
+	for alias := range conns {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+func checkReachability(connBuilder client.ConnBuilder, timeout time.Duration) error {
+	ch := make(chan error, 1)
+	go func() {
+		conn, err := connBuilder.Connect()
+		if err == nil {
+			conn.Close()
+		}
+		ch <- err
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(timeout):
+		return errors.New("timed out")
+	}
+}
+
+func (h setupHelper) connectionBuilder(conn *config.Connection, args *cmdArgs) (client.ConnBuilder, error) {
+	url, err := h.parseServerUrl(conn.Server)
+	if err != nil {
+		return nil, err
+	}
+	protocol := url.protocol
+	if protocol == "" {
+		protocol = conn.Protocol
+	}
+	_, transport := h.resolveProtocol(protocol, args)
+	if transport != TRANSPORT_UNIX && url.port == 0 {
+		return nil, errors.New("no port specified")
+	}
+	return h.newConnBuilder(transport, url, args)
+}
+
+func (h setupHelper) listConnections(printer repl.Printer, args *cmdArgs) {
+	conns, err := config.LoadConnections()
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return
+	}
+	aliases := sortedAliases(conns)
+	if len(aliases) == 0 {
+		fmt.Fprintln(os.Stderr, "No connection registered")
+		return
+	}
+	statuses := make([]error, len(aliases))
+	var wg sync.WaitGroup
+	for i, alias := range aliases {
+		conn := conns[alias]
+		connBuilder, err := h.connectionBuilder(&conn, args)
+		if err != nil {
+			statuses[i] = err
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = checkReachability(connBuilder, reachabilityTimeout)
+		}(i)
+	}
+	wg.Wait()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for i, alias := range aliases {
+		fmt.Fprintf(w, "%s\t%s\t", alias, conns[alias].Server)
+		if err := statuses[i]; err != nil {
+			var opErr *net.OpError
+			if errors.As(err, &opErr) {
+				err = opErr.Err
+			}
+			printer.With(color.FgRed).Fprintf(w, "unreachable (%s)\n", err)
+		} else {
+			printer.With(color.FgGreen).Fprintln(w, "reachable")
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/athos/trenchman/repl"
+	"github.com/fatih/color"
+)
+
+var errReplayDiffered = errors.New("replayed results differed")
+
+// replay evaluates the inputs recorded in the transcript again, and returns
+// errReplayDiffered if any of the results differed from the recorded ones.
+func (h setupHelper) replay(r *repl.Repl, printer repl.Printer, args *cmdArgs) error {
+	f, err := os.Open(*args.replayFile)
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return err
+	}
+	defer f.Close()
+	entries, err := repl.ReadTranscript(f)
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return err
+	}
+	// keep stdout clean for JSON events
+	var out io.Writer = os.Stdout
+	if *args.output == OUTPUT_JSON {
+		out = os.Stderr
+	}
+	differed := 0
+	for i, entry := range entries {
+		actual, err := r.Replay(entry)
+		if err != nil {
+			h.errHandler.HandleErr(err)
+			return err
+		}
+		if repl.SameResult(entry.Result, actual) {
+			continue
+		}
+		differed++
+		fmt.Fprintln(out)
+		printer.With(color.FgRed).Fprintf(out, "DIFF in input %d (ns: %s)\n", i+1, entry.Input.NS)
+		fmt.Fprintf(out, "   input: %s\n", entry.Input.Text)
+		fmt.Fprintf(out, "expected: %s\n", repl.ResultString(entry.Result))
+		fmt.Fprintf(out, "  actual: %s\n", repl.ResultString(actual))
+	}
+	fmt.Fprintf(out, "\nReplayed %d inputs.\n", len(entries))
+	if differed > 0 {
+		printer.With(color.FgRed).Fprintf(out, "%d differences.\n", differed)
+		return errReplayDiffered
+	}
+	printer.With(color.FgGreen).Fprintln(out, "0 differences.")
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/athos/trenchman/config"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	STEP_INIT = "init"
+	STEP_EVAL = "eval"
+	STEP_FILE = "file"
+)
+
+type (
+	// evalStep represents an -i, -e or -f option. Steps are kept in the
+	// order they are given on the command line.
+	evalStep struct {
+		kind string
+		arg  string
+	}
+
+	// stepValue is a repeatable flag value that appends to the steps
+	// shared among the -i, -e and -f options.
+	stepValue struct {
+		kind  string
+		steps *[]evalStep
+	}
+)
+
+func (v *stepValue) Set(s string) error {
+	if s = strings.TrimSpace(s); s != "" {
+		*v.steps = append(*v.steps, evalStep{v.kind, s})
+	}
+	return nil
+}
+
+func (v *stepValue) String() string {
+	ret := []string{}
+	for _, step := range *v.steps {
+		if step.kind == v.kind {
+			ret = append(ret, step.arg)
+		}
+	}
+	return strings.Join(ret, ",")
+}
+
+func (v *stepValue) IsCumulative() bool {
+	return true
+}
+
+// evalSteps defines the -i, -e and -f options, which share the steps.
+func evalSteps(app *kingpin.Application) *[]evalStep {
+	ret := &[]evalStep{}
+	app.Flag("init", "Load a file before execution. Can be repeated.").Short('i').Envar("TRENCHMAN_INIT").PlaceHolder("FILE").SetValue(&stepValue{STEP_INIT, ret})
+	app.Flag("eval", "Evaluate an expression. Can be repeated, and evaluated in order with -f.").Short('e').PlaceHolder("EXPR").SetValue(&stepValue{STEP_EVAL, ret})
+	app.Flag("file", "Evaluate a file. Can be repeated, and evaluated in order with -e.").Short('f').SetValue(&stepValue{STEP_FILE, ret})
+	return ret
+}
+
+func (args *cmdArgs) hasStep(kinds ...string) bool {
+	for _, step := range *args.steps {
+		for _, kind := range kinds {
+			if step.kind == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyStepSettings adds the steps from the settings for the options not
+// given on the command line. The :file and :eval settings are ignored
+// altogether if either -e or -f is given, so that they are never mixed with
+// the steps on the command line. The init file is loaded first.
+func (args *cmdArgs) applyStepSettings(s *config.Settings) {
+	setting := func(kind string, setting *string) []evalStep {
+		if setting == nil || strings.TrimSpace(*setting) == "" {
+			return nil
+		}
+		return []evalStep{{kind, strings.TrimSpace(*setting)}}
+	}
+	var init, rest []evalStep
+	if !args.hasStep(STEP_INIT) {
+		init = setting(STEP_INIT, s.Init)
+	}
+	if !args.hasStep(STEP_EVAL, STEP_FILE) {
+		rest = append(setting(STEP_FILE, s.File), setting(STEP_EVAL, s.Eval)...)
+	}
+	*args.steps = append(append(init, *args.steps...), rest...)
+}
+
+// normalizeArgs rewrites "-f -" and "-i -" into "--file=-" and "--init=-",
+// since kingpin takes "-" for a flag rather than its value. It also marks
+// the arguments after the --script file as the ones for the script, so that
+// a shebang line can pass them as they are.
+func normalizeArgs(args []string) []string {
+	ret := make([]string, 0, len(args)+1)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(ret, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "--script=") {
+			ret = append(ret, arg, "--")
+			return append(ret, args[i+1:]...)
+		}
+		if arg == "--script" && i+1 < len(args) {
+			ret = append(ret, arg, args[i+1], "--")
+			return append(ret, args[i+2:]...)
+		}
+		if i+1 < len(args) && args[i+1] == "-" {
+			switch arg {
+			case "-f", "--file":
+				arg = "--file=-"
+				i++
+			case "-i", "--init":
+				arg = "--init=-"
+				i++
+			}
+		}
+		ret = append(ret, arg)
+	}
+	return ret
+}
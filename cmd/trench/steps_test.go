@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/athos/trenchman/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepValue(t *testing.T) {
+	steps := []evalStep{}
+	init := &stepValue{STEP_INIT, &steps}
+	eval := &stepValue{STEP_EVAL, &steps}
+	file := &stepValue{STEP_FILE, &steps}
+	for _, set := range []struct {
+		value *stepValue
+		arg   string
+	}{
+		{eval, "(foo)"},
+		{file, " bar.clj "},
+		{init, "init.clj"},
+		{eval, "  "},
+		{eval, "(baz)"},
+	} {
+		assert.Nil(t, set.value.Set(set.arg))
+	}
+	assert.Equal(t, []evalStep{
+		{STEP_EVAL, "(foo)"},
+		{STEP_FILE, "bar.clj"},
+		{STEP_INIT, "init.clj"},
+		{STEP_EVAL, "(baz)"},
+	}, steps)
+	assert.Equal(t, "(foo),(baz)", eval.String())
+	assert.Equal(t, "bar.clj", file.String())
+	assert.Equal(t, "init.clj", init.String())
+	assert.True(t, eval.IsCumulative())
+}
+
+func TestApplyStepSettings(t *testing.T) {
+	str := func(s string) *string {
+		return &s
+	}
+	settings := &config.Settings{
+		Init: str("init.clj"),
+		File: str("script.clj"),
+		Eval: str("(run)"),
+	}
+	tests := []struct {
+		title    string
+		steps    []evalStep
+		settings *config.Settings
+		expected []evalStep
+	}{
+		{
+			"no settings",
+			[]evalStep{{STEP_EVAL, "(foo)"}},
+			&config.Settings{},
+			[]evalStep{{STEP_EVAL, "(foo)"}},
+		},
+		{
+			"blank settings",
+			[]evalStep{},
+			&config.Settings{Init: str(" "), Eval: str("")},
+			nil,
+		},
+		{
+			"settings only",
+			[]evalStep{},
+			settings,
+			[]evalStep{{STEP_INIT, "init.clj"}, {STEP_FILE, "script.clj"}, {STEP_EVAL, "(run)"}},
+		},
+		{
+			"init from settings is loaded before the command line steps",
+			[]evalStep{{STEP_EVAL, "(foo)"}},
+			&config.Settings{Init: str("init.clj")},
+			[]evalStep{{STEP_INIT, "init.clj"}, {STEP_EVAL, "(foo)"}},
+		},
+		{
+			"-i overrides init",
+			[]evalStep{{STEP_INIT, "other.clj"}},
+			&config.Settings{Init: str("init.clj")},
+			[]evalStep{{STEP_INIT, "other.clj"}},
+		},
+		{
+			"-e overrides both eval and file",
+			[]evalStep{{STEP_EVAL, "(foo)"}},
+			settings,
+			[]evalStep{{STEP_INIT, "init.clj"}, {STEP_EVAL, "(foo)"}},
+		},
+		{
+			"-f overrides both eval and file",
+			[]evalStep{{STEP_FILE, "foo.clj"}},
+			settings,
+			[]evalStep{{STEP_INIT, "init.clj"}, {STEP_FILE, "foo.clj"}},
+		},
+		{
+			"-i keeps eval and file",
+			[]evalStep{{STEP_INIT, "other.clj"}},
+			settings,
+			[]evalStep{{STEP_INIT, "other.clj"}, {STEP_FILE, "script.clj"}, {STEP_EVAL, "(run)"}},
+		},
+	}
+	for _, tt := range tests {
+		steps := tt.steps
+		args := &cmdArgs{steps: &steps}
+		args.applyStepSettings(tt.settings)
+		assert.Equal(t, tt.expected, *args.steps, tt.title)
+	}
+}
+
+func TestNormalizeArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{}, []string{}},
+		{[]string{"-e", "(foo)"}, []string{"-e", "(foo)"}},
+		{[]string{"-f", "-"}, []string{"--file=-"}},
+		{[]string{"--file", "-", "-e", "(foo)"}, []string{"--file=-", "-e", "(foo)"}},
+		{[]string{"-i", "-", "-f", "-"}, []string{"--init=-", "--file=-"}},
+		{[]string{"-e", "-"}, []string{"-e", "-"}},
+		{[]string{"-f"}, []string{"-f"}},
+		{[]string{"--", "-f", "-"}, []string{"--", "-f", "-"}},
+		{[]string{"--script", "foo.clj", "-f", "-"}, []string{"--script", "foo.clj", "--", "-f", "-"}},
+		{[]string{"--script=foo.clj", "-e", "x"}, []string{"--script=foo.clj", "--", "-e", "x"}},
+		{[]string{"-p", "5555", "--script"}, []string{"-p", "5555", "--script"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, normalizeArgs(tt.args), "%v", tt.args)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/athos/trenchman/repl"
+	"github.com/athos/trenchman/testrunner"
+	"github.com/fatih/color"
+)
+
+// defaultTestDir is where test namespaces are discovered if no targets are
+// specified.
+const defaultTestDir = "test"
+
+var errTestsFailed = errors.New("tests failed")
+
+func testTargets(targets, vars []string) ([]string, error) {
+	if len(targets) > 0 {
+		return targets, nil
+	}
+	for _, v := range vars {
+		if strings.Contains(v, "/") {
+			// the namespaces of the qualified vars are tested
+			return nil, nil
+		}
+	}
+	if _, err := os.Stat(defaultTestDir); err != nil {
+		return nil, fmt.Errorf("no test namespaces specified, and ./%s not found", defaultTestDir)
+	}
+	return []string{defaultTestDir}, nil
+}
+
+func printFailure(out io.Writer, printer repl.Printer, t *testrunner.TestVar, res *testrunner.Result) {
+	label := "FAIL"
+	if res.Type == testrunner.RESULT_ERROR {
+		label = "ERROR"
+	}
+	where := t.NS
+	if t.Var != "" {
+		where = fmt.Sprintf("(%s)", t.Var)
+	}
+	if res.File != "" {
+		where += fmt.Sprintf(" (%s:%d)", res.File, res.Line)
+	}
+	fmt.Fprintln(out)
+	printer.With(color.FgRed).Fprintf(out, "%s in %s\n", label, where)
+	fmt.Fprint(out, res.Description())
+}
+
+// runTests runs the tests in the namespaces selected by the arguments of
+// the test command, and returns errTestsFailed if any of them failed.
+func (h setupHelper) runTests(r *repl.Repl, printer repl.Printer, args *cmdArgs) error {
+	targets, err := testTargets(*args.testTargets, *args.testVars)
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return err
+	}
+	sels, err := testrunner.Select(targets, *args.testVars)
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return err
+	}
+	// keep stdout clean for JSON events
+	var out io.Writer = os.Stdout
+	if *args.output == OUTPUT_JSON {
+		out = os.Stderr
+	}
+	runner := testrunner.NewRunner(r)
+	tests := []*testrunner.TestVar{}
+	for _, sel := range sels {
+		fmt.Fprintf(out, "\nTesting %s\n", sel.NS)
+		results, err := runner.Run(sel)
+		if err != nil {
+			h.errHandler.HandleErr(err)
+			return err
+		}
+		for _, t := range results {
+			for _, res := range t.Failures() {
+				printFailure(out, printer, t, res)
+			}
+		}
+		tests = append(tests, results...)
+	}
+	summary := testrunner.Summarize(tests)
+	fmt.Fprintf(out, "\nRan %d tests containing %d assertions.\n", summary.Vars, summary.Tests)
+	summaryPrinter := printer.With(color.FgGreen)
+	if !summary.Succeeded() {
+		summaryPrinter = printer.With(color.FgRed)
+	}
+	summaryPrinter.Fprintf(out, "%d failures, %d errors.\n", summary.Fail, summary.Error)
+	if *args.junit != "" {
+		f, err := os.Create(*args.junit)
+		if err != nil {
+			h.errHandler.HandleErr(err)
+			return err
+		}
+		defer f.Close()
+		if err := testrunner.WriteJUnit(f, tests); err != nil {
+			h.errHandler.HandleErr(err)
+			return err
+		}
+	}
+	if !summary.Succeeded() {
+		return errTestsFailed
+	}
+	return nil
+}
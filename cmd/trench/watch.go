@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/repl"
+	"github.com/athos/trenchman/watcher"
+	"github.com/fatih/color"
+)
+
+const defaultWatchInterval = 500 * time.Millisecond
+
+// errorSummary describes the error in a line for the reload summary,
+// e.g. "java.lang.RuntimeException in compile-syntax-check at core.clj:3:1".
+func errorSummary(err error) string {
+	var rtErr *client.RuntimeError
+	if !errors.As(err, &rtErr) || rtErr.Details() == nil {
+		return strings.SplitN(err.Error(), "\n", 2)[0]
+	}
+	details := rtErr.Details()
+	parts := []string{}
+	if details.Class != "" {
+		parts = append(parts, details.Class)
+	}
+	if details.Phase != "" {
+		parts = append(parts, "in "+details.Phase)
+	}
+	if details.Source != "" || details.Line > 0 {
+		loc := fmt.Sprintf("at %s:%d", details.Source, details.Line)
+		if details.Column > 0 {
+			loc += fmt.Sprintf(":%d", details.Column)
+		}
+		parts = append(parts, loc)
+	}
+	if len(parts) == 0 {
+		return strings.SplitN(err.Error(), "\n", 2)[0]
+	}
+	return strings.Join(parts, " ")
+}
+
+// watch reloads the changed files under the watched paths until the
+// process is terminated.
+func (h setupHelper) watch(r *repl.Repl, printer repl.Printer, args *cmdArgs) {
+	w, err := watcher.New(*args.watch)
+	if err != nil {
+		h.errHandler.HandleErr(err)
+		return
+	}
+	// keep stdout clean for JSON events
+	var out io.Writer = os.Stdout
+	if *args.output == OUTPUT_JSON {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "Watching %s for changes...\n", strings.Join(*args.watch, ", "))
+	err = w.Watch(*args.watchInterval, nil, func(files []string) {
+		fmt.Fprintf(out, "[%s] Reloading %d file(s)\n", time.Now().Format("15:04:05"), len(files))
+		failed := false
+		for _, file := range files {
+			if _, err := os.Stat(file); err != nil {
+				// removed after the change was detected
+				continue
+			}
+			if err := r.LoadWithResultVisibility(file, true); err != nil {
+				failed = true
+				printer.With(color.FgRed).Fprintf(out, "  FAILED %s (%s)\n", file, errorSummary(err))
+			} else {
+				printer.With(color.FgGreen).Fprintf(out, "  ok     %s\n", file)
+			}
+		}
+		if !failed && *args.watchEval != "" {
+			r.Eval(*args.watchEval)
+		}
+	})
+	if err != nil {
+		h.errHandler.HandleErr(err)
+	}
+}
@@ -0,0 +1,407 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"olympos.io/encoding/edn"
+)
+
+const (
+	ProjectFile = ".trenchman.edn"
+	UserFile    = "trenchman/config.edn"
+)
+
+type (
+	Duration struct {
+		time.Duration
+	}
+
+	Settings struct {
+		Port             *int      `edn:"port"`
+		PortFile         *string   `edn:"port-file"`
+		Protocol         *string   `edn:"protocol"`
+		Server           *string   `edn:"server"`
+		RetryTimeout     *Duration `edn:"retry-timeout"`
+		RetryInterval    *Duration `edn:"retry-interval"`
+		RetryMaxInterval *Duration `edn:"retry-max-interval"`
+		RetryBackoff     *float64  `edn:"retry-backoff"`
+		RetryJitter      *float64  `edn:"retry-jitter"`
+		RetryMaxAttempts *int      `edn:"retry-max-attempts"`
+		RetryProgress    *bool     `edn:"retry-progress"`
+		ConnectTimeout   *Duration `edn:"connect-timeout"`
+		Reconnect        *bool     `edn:"reconnect"`
+		Launch           *string   `edn:"launch"`
+		LaunchDaemon     *bool     `edn:"launch-daemon"`
+		LaunchLog        *string   `edn:"launch-log"`
+		Init             *string   `edn:"init"`
+		Eval             *string   `edn:"eval"`
+		File             *string   `edn:"file"`
+		Main             *string   `edn:"main"`
+		Watch            []string  `edn:"watch"`
+		WatchEval        *string   `edn:"watch-eval"`
+		WatchInterval    *Duration `edn:"watch-interval"`
+		KeepGoing        *bool     `edn:"keep-going"`
+		Stream           *bool     `edn:"stream"`
+		InitNS           *string   `edn:"init-ns"`
+		Color            *string   `edn:"color"`
+		Output           *string   `edn:"output"`
+		TLS              *bool     `edn:"tls"`
+		TLSCA            *string   `edn:"tls-ca"`
+		TLSCert          *string   `edn:"tls-cert"`
+		TLSKey           *string   `edn:"tls-key"`
+		TLSServerName    *string   `edn:"tls-server-name"`
+		TLSInsecure      *bool     `edn:"tls-insecure"`
+		SSHIdentity      *string   `edn:"ssh-identity"`
+		SSHKnownHosts    *string   `edn:"ssh-known-hosts"`
+		Proxy            *string   `edn:"proxy"`
+		Debug            *bool     `edn:"debug"`
+		Args             []string  `edn:"args"`
+		CommandPrefix    *string   `edn:"command-prefix"`
+		Commands         Commands  `edn:"commands"`
+	}
+
+	// Commands are user-defined REPL commands keyed by name.
+	Commands map[edn.Keyword]Command
+
+	// Command is a user-defined REPL command, which evaluates the code
+	// template with the placeholders replaced.
+	Command struct {
+		Code string `edn:"code"`
+		Help string `edn:"help"`
+	}
+
+	Connection struct {
+		Server   string `edn:"server"`
+		Protocol string `edn:"protocol"`
+		InitNS   string `edn:"init-ns"`
+		Init     string `edn:"init"`
+	}
+
+	Config struct {
+		Settings
+		Profiles    map[edn.Keyword]Settings   `edn:"profiles"`
+		Connections map[edn.Keyword]Connection `edn:"connections"`
+	}
+)
+
+var ErrProfileNotFound = errors.New("profile not found")
+
+func (d *Duration) UnmarshalEDN(bs []byte) error {
+	var s string
+	if err := edn.Unmarshal(bs, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %s", bs)
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (s *Settings) validate() error {
+	if s.Protocol != nil {
+		switch *s.Protocol {
+		case "n", "nrepl", "p", "prepl":
+		default:
+			return fmt.Errorf("unknown protocol: %s", *s.Protocol)
+		}
+	}
+	if s.Color != nil {
+		switch *s.Color {
+		case "none", "auto", "always":
+		default:
+			return fmt.Errorf("unknown color option: %s", *s.Color)
+		}
+	}
+	if s.Output != nil {
+		switch *s.Output {
+		case "text", "json":
+		default:
+			return fmt.Errorf("unknown output format: %s", *s.Output)
+		}
+	}
+	if s.RetryJitter != nil && (*s.RetryJitter < 0 || *s.RetryJitter > 1) {
+		return fmt.Errorf("retry jitter must be between 0 and 1: %v", *s.RetryJitter)
+	}
+	if s.CommandPrefix != nil && (*s.CommandPrefix == "" || strings.ContainsAny(*s.CommandPrefix, " \t\n")) {
+		return fmt.Errorf("command prefix must be non-empty and have no whitespace: %q", *s.CommandPrefix)
+	}
+	for name, cmd := range s.Commands {
+		if cmd.Code == "" {
+			return fmt.Errorf("command %s has no :code", name)
+		}
+	}
+	return nil
+}
+
+// Merge fills in the settings that are not set in s with the ones in other.
+func (s *Settings) Merge(other *Settings) {
+	if s.Port == nil {
+		s.Port = other.Port
+	}
+	if s.PortFile == nil {
+		s.PortFile = other.PortFile
+	}
+	if s.Protocol == nil {
+		s.Protocol = other.Protocol
+	}
+	if s.Server == nil {
+		s.Server = other.Server
+	}
+	if s.RetryTimeout == nil {
+		s.RetryTimeout = other.RetryTimeout
+	}
+	if s.RetryInterval == nil {
+		s.RetryInterval = other.RetryInterval
+	}
+	if s.RetryMaxInterval == nil {
+		s.RetryMaxInterval = other.RetryMaxInterval
+	}
+	if s.RetryBackoff == nil {
+		s.RetryBackoff = other.RetryBackoff
+	}
+	if s.RetryJitter == nil {
+		s.RetryJitter = other.RetryJitter
+	}
+	if s.RetryMaxAttempts == nil {
+		s.RetryMaxAttempts = other.RetryMaxAttempts
+	}
+	if s.RetryProgress == nil {
+		s.RetryProgress = other.RetryProgress
+	}
+	if s.ConnectTimeout == nil {
+		s.ConnectTimeout = other.ConnectTimeout
+	}
+	if s.Reconnect == nil {
+		s.Reconnect = other.Reconnect
+	}
+	if s.Launch == nil {
+		s.Launch = other.Launch
+	}
+	if s.LaunchDaemon == nil {
+		s.LaunchDaemon = other.LaunchDaemon
+	}
+	if s.LaunchLog == nil {
+		s.LaunchLog = other.LaunchLog
+	}
+	if s.Init == nil {
+		s.Init = other.Init
+	}
+	if s.Eval == nil {
+		s.Eval = other.Eval
+	}
+	if s.File == nil {
+		s.File = other.File
+	}
+	if s.Main == nil {
+		s.Main = other.Main
+	}
+	if s.Watch == nil {
+		s.Watch = other.Watch
+	}
+	if s.WatchEval == nil {
+		s.WatchEval = other.WatchEval
+	}
+	if s.WatchInterval == nil {
+		s.WatchInterval = other.WatchInterval
+	}
+	if s.KeepGoing == nil {
+		s.KeepGoing = other.KeepGoing
+	}
+	if s.Stream == nil {
+		s.Stream = other.Stream
+	}
+	if s.InitNS == nil {
+		s.InitNS = other.InitNS
+	}
+	if s.Color == nil {
+		s.Color = other.Color
+	}
+	if s.Output == nil {
+		s.Output = other.Output
+	}
+	if s.TLS == nil {
+		s.TLS = other.TLS
+	}
+	if s.TLSCA == nil {
+		s.TLSCA = other.TLSCA
+	}
+	if s.TLSCert == nil {
+		s.TLSCert = other.TLSCert
+	}
+	if s.TLSKey == nil {
+		s.TLSKey = other.TLSKey
+	}
+	if s.TLSServerName == nil {
+		s.TLSServerName = other.TLSServerName
+	}
+	if s.TLSInsecure == nil {
+		s.TLSInsecure = other.TLSInsecure
+	}
+	if s.SSHIdentity == nil {
+		s.SSHIdentity = other.SSHIdentity
+	}
+	if s.SSHKnownHosts == nil {
+		s.SSHKnownHosts = other.SSHKnownHosts
+	}
+	if s.Proxy == nil {
+		s.Proxy = other.Proxy
+	}
+	if s.Debug == nil {
+		s.Debug = other.Debug
+	}
+	if s.Args == nil {
+		s.Args = other.Args
+	}
+	if s.CommandPrefix == nil {
+		s.CommandPrefix = other.CommandPrefix
+	}
+	// commands are merged one by one, so that the project config can add
+	// commands to the ones in the user config
+	for name, cmd := range other.Commands {
+		if s.Commands == nil {
+			s.Commands = Commands{}
+		}
+		if _, ok := s.Commands[name]; !ok {
+			s.Commands[name] = cmd
+		}
+	}
+}
+
+func ReadFile(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := edn.Unmarshal(content, &c); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s (%w)", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s (%w)", path, err)
+	}
+	for name, profile := range c.Profiles {
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile %s in config file %s (%w)", name, path, err)
+		}
+	}
+	for name, conn := range c.Connections {
+		if err := conn.Settings().validate(); err != nil {
+			return nil, fmt.Errorf("invalid connection %s in config file %s (%w)", name, path, err)
+		}
+	}
+	return &c, nil
+}
+
+func (conn *Connection) Settings() *Settings {
+	s := &Settings{}
+	if conn.Server != "" {
+		s.Server = &conn.Server
+	}
+	if conn.Protocol != "" {
+		s.Protocol = &conn.Protocol
+	}
+	if conn.InitNS != "" {
+		s.InitNS = &conn.InitNS
+	}
+	if conn.Init != "" {
+		s.Init = &conn.Init
+	}
+	return s
+}
+
+// Resolve returns the settings for the given profile, falling back to
+// the top-level settings of the config. The empty profile name stands for
+// the top-level settings themselves.
+func (c *Config) Resolve(profile string) (*Settings, bool) {
+	ret := c.Settings
+	if profile == "" {
+		return &ret, true
+	}
+	p, ok := c.Profiles[edn.Keyword(profile)]
+	if !ok {
+		return &ret, false
+	}
+	p.Merge(&ret)
+	return &p, true
+}
+
+func UserConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, UserFile), nil
+}
+
+// Load reads the project config and the user config, and merges them
+// into a single Settings. Settings in the project config take precedence
+// over the ones in the user config.
+func Load(profile string) (*Settings, error) {
+	return loadFiles(configPaths(), profile)
+}
+
+// LoadConnections reads the connection registry from the config files.
+// Connections in the project config shadow the ones with the same alias
+// in the user config.
+func LoadConnections() (map[string]Connection, error) {
+	return loadConnections(configPaths())
+}
+
+func configPaths() []string {
+	paths := []string{ProjectFile}
+	if path, err := UserConfigPath(); err == nil {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func loadConnections(paths []string) (map[string]Connection, error) {
+	ret := map[string]Connection{}
+	for _, path := range paths {
+		c, err := ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for alias, conn := range c.Connections {
+			if _, ok := ret[string(alias)]; !ok {
+				ret[string(alias)] = conn
+			}
+		}
+	}
+	return ret, nil
+}
+
+func loadFiles(paths []string, profile string) (*Settings, error) {
+	ret := &Settings{}
+	found := profile == ""
+	for _, path := range paths {
+		c, err := ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		settings, ok := c.Resolve(profile)
+		found = found || ok
+		ret.Merge(settings)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, profile)
+	}
+	return ret, nil
+}
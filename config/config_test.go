@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.edn", `
+{:server "prepl://localhost:5555"
+ :init "dev/init.clj"
+ :init-ns "dev"
+ :color "always"
+ :debug true
+ :retry-timeout "10s"
+ :profiles {:staging {:server "nrepl://staging:7888"}}}`)
+	c, err := ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "prepl://localhost:5555", *c.Server)
+	assert.Equal(t, "dev/init.clj", *c.Init)
+	assert.Equal(t, "dev", *c.InitNS)
+	assert.Equal(t, "always", *c.Color)
+	assert.True(t, *c.Debug)
+	assert.Equal(t, 10*time.Second, c.RetryTimeout.Duration)
+	assert.Nil(t, c.Port)
+	assert.Equal(t, "nrepl://staging:7888", *c.Profiles["staging"].Server)
+}
+
+func TestReadFileErrors(t *testing.T) {
+	tests := []struct {
+		title   string
+		content string
+	}{
+		{"malformed", `{:server`},
+		{"bad color", `{:color "sometimes"}`},
+		{"bad protocol", `{:protocol "http"}`},
+		{"bad output", `{:output "xml"}`},
+		{"bad duration", `{:retry-timeout "soon"}`},
+		{"bad profile", `{:profiles {:dev {:color "sometimes"}}}`},
+		{"empty command prefix", `{:command-prefix ""}`},
+		{"command without code", `{:commands {:reset {:help "Reset the system."}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			path := writeConfig(t, t.TempDir(), "config.edn", tt.content)
+			_, err := ReadFile(path)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	project := writeConfig(t, dir, "project.edn", `
+{:init-ns "project"
+ :profiles {:dev {:port 3000}}}`)
+	user := writeConfig(t, dir, "user.edn", `
+{:init-ns "user-ns"
+ :color "none"
+ :port 1234
+ :profiles {:dev {:color "always"}
+            :ci {:server "prepl://ci"}}}`)
+	missing := filepath.Join(dir, "missing.edn")
+	paths := []string{project, missing, user}
+
+	s, err := loadFiles(paths, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "project", *s.InitNS)
+	assert.Equal(t, "none", *s.Color)
+	assert.Equal(t, 1234, *s.Port)
+	assert.Nil(t, s.Server)
+
+	s, err = loadFiles(paths, "dev")
+	assert.Nil(t, err)
+	assert.Equal(t, "project", *s.InitNS)
+	assert.Equal(t, "always", *s.Color)
+	assert.Equal(t, 3000, *s.Port)
+
+	s, err = loadFiles(paths, "ci")
+	assert.Nil(t, err)
+	assert.Equal(t, "prepl://ci", *s.Server)
+	assert.Equal(t, 1234, *s.Port)
+
+	_, err = loadFiles(paths, "nonexistent")
+	assert.ErrorIs(t, err, ErrProfileNotFound)
+}
+
+func TestLoadCommands(t *testing.T) {
+	dir := t.TempDir()
+	project := writeConfig(t, dir, "project.edn", `
+{:commands {:reset {:code "(integrant.repl/reset)" :help "Reset the system."}}}`)
+	user := writeConfig(t, dir, "user.edn", `
+{:command-prefix ":repl/"
+ :commands {:reset {:code "(user/reset)"}
+            :tap {:code "(tap> {{args}})"}}}`)
+	s, err := loadFiles([]string{project, user}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, ":repl/", *s.CommandPrefix)
+	assert.Equal(t, Commands{
+		"reset": {Code: "(integrant.repl/reset)", Help: "Reset the system."},
+		"tap":   {Code: "(tap> {{args}})"},
+	}, s.Commands)
+}
+
+func TestLoadConnections(t *testing.T) {
+	dir := t.TempDir()
+	project := writeConfig(t, dir, "project.edn", `
+{:connections {:dev {:server "nrepl://localhost:7888" :init-ns "dev"}}}`)
+	user := writeConfig(t, dir, "user.edn", `
+{:connections {:dev {:server "nrepl://localhost:1234"}
+               :ci {:server "prepl://ci:5555" :init "ci.clj"}}}`)
+	conns, err := loadConnections([]string{project, user})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]Connection{
+		"dev": {Server: "nrepl://localhost:7888", InitNS: "dev"},
+		"ci":  {Server: "prepl://ci:5555", Init: "ci.clj"},
+	}, conns)
+
+	bad := writeConfig(t, dir, "bad.edn", `{:connections {:dev {:protocol "http"}}}`)
+	_, err = loadConnections([]string{bad})
+	assert.NotNil(t, err)
+}
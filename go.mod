@@ -7,6 +7,7 @@ require (
 	github.com/google/uuid v1.3.0
 	github.com/mattn/go-isatty v0.0.14
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	olympos.io/encoding/edn v0.0.0-20201019073823-d3554ca0b0a3
 )
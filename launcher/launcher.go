@@ -0,0 +1,180 @@
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/athos/trenchman/client"
+)
+
+const pollInterval = 100 * time.Millisecond
+
+var announcementRegex = regexp.MustCompile(`nREPL server started on port (\d+)`)
+
+type (
+	Opts struct {
+		// Command is a shell command line to start the server with.
+		Command string
+		// LogFile is the file to which the output of the server is written.
+		// If empty, a temporary file is created.
+		LogFile string
+		// PortFile is the port file the server is expected to write.
+		PortFile string
+		// Daemon makes the server keep running after Trenchman exits.
+		Daemon bool
+	}
+
+	Server struct {
+		cmd        *exec.Cmd
+		logFile    string
+		tempLog    bool
+		portFile   string
+		daemon     bool
+		startedAt  time.Time
+		exited     chan struct{}
+		lock       sync.Mutex
+		exitErr    error
+		stopOnce   sync.Once
+		stopResult error
+	}
+)
+
+var ErrNoPortAnnounced = errors.New("server did not announce its port in time")
+
+func Start(opts *Opts) (*Server, error) {
+	logFile := opts.LogFile
+	var log *os.File
+	var err error
+	if logFile == "" {
+		log, err = os.CreateTemp("", "trenchman-server-*.log")
+	} else {
+		log, err = os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create log file (%w)", err)
+	}
+	defer log.Close()
+	cmd := shellCommand(opts.Command)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = sysProcAttr(opts.Daemon)
+	s := &Server{
+		cmd:       cmd,
+		logFile:   log.Name(),
+		tempLog:   opts.LogFile == "",
+		portFile:  opts.PortFile,
+		daemon:    opts.Daemon,
+		startedAt: time.Now(),
+		exited:    make(chan struct{}),
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not launch server (%w)", err)
+	}
+	go func() {
+		err := cmd.Wait()
+		s.lock.Lock()
+		if err == nil {
+			err = errors.New("exit status 0")
+		}
+		s.exitErr = err
+		s.lock.Unlock()
+		close(s.exited)
+	}()
+	return s, nil
+}
+
+func (s *Server) Pid() int {
+	return s.cmd.Process.Pid
+}
+
+func (s *Server) LogFile() string {
+	return s.logFile
+}
+
+// Err returns a non-nil error if the server process has exited.
+func (s *Server) Err() error {
+	select {
+	case <-s.exited:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return fmt.Errorf("server process exited (%v); see %s", s.exitErr, s.logFile)
+	default:
+		return nil
+	}
+}
+
+func (s *Server) announcedPort() (int, bool) {
+	content, err := os.ReadFile(s.logFile)
+	if err != nil {
+		return 0, false
+	}
+	m := announcementRegex.FindSubmatch(content)
+	if m == nil {
+		return 0, false
+	}
+	port, err := strconv.Atoi(string(m[1]))
+	return port, err == nil
+}
+
+func (s *Server) portFromPortFile() (int, bool) {
+	if s.portFile == "" {
+		return 0, false
+	}
+	info, err := os.Stat(s.portFile)
+	// ignore stale port files left by servers that were started before
+	// (allowing for file systems with coarse mtime granularity)
+	if err != nil || info.ModTime().Before(s.startedAt.Add(-time.Second)) {
+		return 0, false
+	}
+	port, err := client.ReadPortFile(s.portFile)
+	return port, err == nil
+}
+
+// WaitForPort waits until the server announces the port it's listening on,
+// either by printing "nREPL server started on port N" or by writing the
+// port file.
+func (s *Server) WaitForPort(timeout time.Duration) (int, error) {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if port, ok := s.announcedPort(); ok {
+			return port, nil
+		}
+		if port, ok := s.portFromPortFile(); ok {
+			return port, nil
+		}
+		if err := s.Err(); err != nil {
+			return 0, err
+		}
+		select {
+		case <-deadline:
+			return 0, fmt.Errorf("%w; see %s", ErrNoPortAnnounced, s.logFile)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop terminates the server process unless it's launched as a daemon.
+func (s *Server) Stop() error {
+	if s.daemon {
+		return nil
+	}
+	s.stopOnce.Do(func() {
+		if s.Err() != nil {
+			// keep the log for investigating why the server exited
+			return
+		}
+		s.stopResult = terminate(s.cmd.Process, s.exited)
+		if s.tempLog {
+			os.Remove(s.logFile)
+		}
+	})
+	return s.stopResult
+}
@@ -0,0 +1,98 @@
+//go:build !windows
+
+package launcher
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHelperProcess is not a real test. It's run as a fake nREPL server
+// by the other tests.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("TRENCHMAN_FAKE_SERVER")
+	if mode == "" {
+		return
+	}
+	if mode == "fail" {
+		fmt.Println("Could not start server")
+		os.Exit(1)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.Exit(1)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	switch mode {
+	case "announce":
+		fmt.Printf("nREPL server started on port %d on host 127.0.0.1 - nrepl://127.0.0.1:%d\n", port, port)
+	case "port-file":
+		os.WriteFile(os.Getenv("TRENCHMAN_PORT_FILE"), []byte(strconv.Itoa(port)), 0644)
+	}
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+func fakeServerCommand(mode string) string {
+	return fmt.Sprintf("TRENCHMAN_FAKE_SERVER=%s exec %q -test.run=TestHelperProcess", mode, os.Args[0])
+}
+
+func TestWaitForPort(t *testing.T) {
+	for _, mode := range []string{"announce", "port-file"} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			portFile := filepath.Join(dir, ".nrepl-port")
+			t.Setenv("TRENCHMAN_PORT_FILE", portFile)
+			s, err := Start(&Opts{
+				Command:  fakeServerCommand(mode),
+				LogFile:  filepath.Join(dir, "server.log"),
+				PortFile: portFile,
+			})
+			assert.Nil(t, err)
+			defer s.Stop()
+			port, err := s.WaitForPort(10 * time.Second)
+			assert.Nil(t, err)
+			conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+			assert.Nil(t, err)
+			conn.Close()
+			assert.Nil(t, s.Stop())
+			assert.NotNil(t, s.Err())
+		})
+	}
+}
+
+func TestWaitForPortErrors(t *testing.T) {
+	s, err := Start(&Opts{Command: fakeServerCommand("fail")})
+	assert.Nil(t, err)
+	_, err = s.WaitForPort(10 * time.Second)
+	assert.Contains(t, err.Error(), "server process exited")
+	content, _ := os.ReadFile(s.LogFile())
+	assert.Equal(t, "Could not start server\n", string(content))
+	s.Stop()
+
+	s, err = Start(&Opts{Command: fakeServerCommand("silent")})
+	assert.Nil(t, err)
+	defer s.Stop()
+	_, err = s.WaitForPort(300 * time.Millisecond)
+	assert.ErrorIs(t, err, ErrNoPortAnnounced)
+}
+
+func TestStalePortFile(t *testing.T) {
+	dir := t.TempDir()
+	portFile := filepath.Join(dir, ".nrepl-port")
+	os.WriteFile(portFile, []byte("1"), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(portFile, old, old)
+	s, err := Start(&Opts{Command: fakeServerCommand("silent"), PortFile: portFile})
+	assert.Nil(t, err)
+	defer s.Stop()
+	_, err = s.WaitForPort(300 * time.Millisecond)
+	assert.ErrorIs(t, err, ErrNoPortAnnounced)
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package launcher
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const killTimeout = 5 * time.Second
+
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+func sysProcAttr(daemon bool) *syscall.SysProcAttr {
+	if daemon {
+		// detach from the controlling terminal so that the server survives
+		// after the terminal is closed
+		return &syscall.SysProcAttr{Setsid: true}
+	}
+	// run in its own process group so that the whole process tree can be
+	// terminated at once
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+func terminate(process *os.Process, exited <-chan struct{}) error {
+	pgid := -process.Pid
+	if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(killTimeout):
+		return syscall.Kill(pgid, syscall.SIGKILL)
+	}
+}
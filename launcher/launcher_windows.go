@@ -0,0 +1,34 @@
+//go:build windows
+
+package launcher
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+)
+
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+func sysProcAttr(daemon bool) *syscall.SysProcAttr {
+	flags := uint32(createNewProcessGroup)
+	if daemon {
+		flags |= detachedProcess
+	}
+	return &syscall.SysProcAttr{CreationFlags: flags}
+}
+
+func terminate(process *os.Process, exited <-chan struct{}) error {
+	if err := process.Kill(); err != nil {
+		return err
+	}
+	<-exited
+	return nil
+}
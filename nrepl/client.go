@@ -22,6 +22,7 @@ type (
 		lock           sync.RWMutex
 		ns             string
 		pending        map[string]chan client.EvalResult
+		ops            map[string]chan map[string]interface{}
 		inputRequested bool
 		inputBuffer    *strings.Builder
 	}
@@ -48,6 +49,7 @@ func NewClient(opts *Opts) (*Client, error) {
 		ns:            initNS,
 		done:          make(chan struct{}),
 		pending:       map[string]chan client.EvalResult{},
+		ops:           map[string]chan map[string]interface{}{},
 		idGenerator:   opts.idGenerator,
 	}
 	conn, err := Connect(&ConnOpts{opts.ConnBuilder, opts.Debug, c})
@@ -85,6 +87,15 @@ func (c *Client) CurrentNS() string {
 	return c.ns
 }
 
+// Session returns the ID of the session, or an empty string if no session
+// is created.
+func (c *Client) Session() string {
+	if c.sessionInfo == nil {
+		return ""
+	}
+	return c.sessionInfo.session
+}
+
 func (c *Client) SupportsOp(op string) bool {
 	if c.sessionInfo == nil {
 		return false
@@ -115,6 +126,15 @@ func (c *Client) statusContains(datum bencode.Datum, status string) bool {
 func (c *Client) HandleResp(response client.Response) {
 	//fmt.Printf("RESP: %v\n", resp)
 	resp := response.(Response)
+	if id, ok := resp["id"].(string); ok {
+		c.lock.RLock()
+		ch, ok := c.ops[id]
+		c.lock.RUnlock()
+		if ok {
+			c.handleOpResp(id, ch, resp)
+			return
+		}
+	}
 	switch {
 	case has(resp, "value"):
 		id := resp["id"].(string)
@@ -130,7 +150,9 @@ func (c *Client) HandleResp(response client.Response) {
 		c.lock.RLock()
 		ch := c.pending[id]
 		c.lock.RUnlock()
-		ch <- client.NewRuntimeError(resp["ex"].(string))
+		ex := resp["ex"].(string)
+		details := &client.ErrorDetails{Class: strings.TrimPrefix(ex, "class ")}
+		ch <- client.NewRuntimeErrorWithDetails(ex, details)
 	case has(resp, "out"):
 		c.outputHandler.Out(resp["out"].(string))
 	case has(resp, "err"):
@@ -143,6 +165,26 @@ func (c *Client) HandleResp(response client.Response) {
 	}
 }
 
+func (c *Client) handleOpResp(id string, ch chan map[string]interface{}, resp Response) {
+	if out, ok := resp["out"].(string); ok {
+		c.outputHandler.Out(out)
+	}
+	if err, ok := resp["err"].(string); ok {
+		c.outputHandler.Err(err)
+	}
+	ret := make(map[string]interface{}, len(resp))
+	for k, v := range resp {
+		ret[k] = v
+	}
+	ch <- ret
+	if has(resp, "status") && c.statusContains(resp["status"], "done") {
+		c.lock.Lock()
+		delete(c.ops, id)
+		c.lock.Unlock()
+		close(ch)
+	}
+}
+
 func (c *Client) HandleErr(err error) {
 	c.errHandler.HandleErr(err)
 }
@@ -173,7 +215,7 @@ func (c *Client) handleStatusUpdate(resp Response) {
 }
 
 func (c *Client) send(req Request) {
-	if c.sessionInfo != nil {
+	if _, ok := req["session"]; !ok && c.sessionInfo != nil {
 		req["session"] = c.sessionInfo.session
 	}
 	if err := c.conn.Send(req); err != nil {
@@ -210,13 +252,38 @@ func (c *Client) Load(filename string, content string) <-chan client.EvalResult
 		"file": content,
 	}
 	if filename != "-" {
-		req["file-name"] = filepath.Base(filename)
-		req["file-path"] = filepath.Dir(filename)
+		path, err := filepath.Abs(filename)
+		if err != nil {
+			path = filename
+		}
+		req["file-name"] = filepath.Base(path)
+		req["file-path"] = path
 	}
 	c.send(req)
 	return ch
 }
 
+// SendOp sends the op to the server, and returns the channel that receives
+// the responses to it. Outputs in the responses are also passed to the
+// output handler. The caller must receive from the channel until it is
+// closed, since the responses to the other requests are not handled until
+// each response is received.
+func (c *Client) SendOp(req map[string]interface{}) <-chan map[string]interface{} {
+	id := c.idGenerator()
+	ch := make(chan map[string]interface{})
+	c.lock.Lock()
+	c.ops[id] = ch
+	c.lock.Unlock()
+	r := Request{"id": id}
+	for k, v := range req {
+		if _, ok := r[k]; !ok {
+			r[k] = v
+		}
+	}
+	c.send(r)
+	return ch
+}
+
 func (c *Client) sendStdin(in string) {
 	c.send(Request{
 		"op":    "stdin",
@@ -247,6 +314,9 @@ func (c *Client) Interrupt() {
 	for id := range c.pending {
 		ids = append(ids, id)
 	}
+	for id := range c.ops {
+		ids = append(ids, id)
+	}
 	c.lock.RUnlock()
 	for _, id := range ids {
 		c.send(Request{
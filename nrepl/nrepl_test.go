@@ -159,7 +159,10 @@ func TestEval(t *testing.T) {
 				},
 			},
 			"user",
-			client.NewRuntimeError("class java.lang.ArithmeticException"),
+			client.NewRuntimeErrorWithDetails(
+				"class java.lang.ArithmeticException",
+				&client.ErrorDetails{Class: "java.lang.ArithmeticException"},
+			),
 			nil,
 			[]string{"Divide by zero\n"},
 		},
@@ -302,7 +305,7 @@ func TestLoad(t *testing.T) {
 				"ns":        "user",
 				"file":      "(println \"Hello, World!\")",
 				"file-name": "hello.clj",
-				"file-path": ".",
+				"file-path": "/src/hello.clj",
 			},
 			responses: []map[string]bencode.Datum{
 				{"out": "Hello, World!\n"},
@@ -314,7 +317,7 @@ func TestLoad(t *testing.T) {
 	mock := setupMock(steps, true)
 	c, err := setupClient(mock)
 	assert.Nil(t, err)
-	ch := c.Load("hello.clj", "(println \"Hello, World!\")")
+	ch := c.Load("/src/hello.clj", "(println \"Hello, World!\")")
 	ret := <-ch
 	assert.Equal(t, "nil", ret)
 	assert.Equal(t, "user", c.CurrentNS())
@@ -372,7 +375,10 @@ func TestInterrupt(t *testing.T) {
 	ch := c.Eval("(Thread/sleep 10000)")
 	c.Interrupt()
 	ret := <-ch
-	assert.Equal(t, client.NewRuntimeError("class java.lang.InterruptedException"), ret)
+	assert.Equal(t, client.NewRuntimeErrorWithDetails(
+		"class java.lang.InterruptedException",
+		&client.ErrorDetails{Class: "java.lang.InterruptedException"},
+	), ret)
 	assert.Equal(t, "user", c.CurrentNS())
 	assert.Nil(t, mock.HandledErr())
 	assert.Nil(t, mock.Outs())
@@ -383,3 +389,168 @@ func TestInterrupt(t *testing.T) {
 	)
 	assert.Nil(t, c.Close())
 }
+
+func TestInterruptOp(t *testing.T) {
+	steps := []step{
+		{
+			expected: map[string]bencode.Datum{
+				"session": SESSION_ID,
+				"id":      EXEC_ID,
+				"op":      "test",
+				"ns":      "foo.core-test",
+			},
+			responses: nil,
+		},
+		{
+			expected: map[string]bencode.Datum{
+				"session":      SESSION_ID,
+				"op":           "interrupt",
+				"interrupt-id": EXEC_ID,
+			},
+			responses: []map[string]bencode.Datum{
+				{
+					"session": SESSION_ID,
+					"id":      EXEC_ID,
+					"status":  []bencode.Datum{"done", "interrupted"},
+				},
+				{
+					"session": SESSION_ID,
+					"status":  []bencode.Datum{"done"},
+				},
+			},
+		},
+	}
+	mock := setupMock(steps, false)
+	c, err := setupClient(mock)
+	assert.Nil(t, err)
+	ch := c.SendOp(map[string]interface{}{"op": "test", "ns": "foo.core-test"})
+	c.Interrupt()
+	resps := []map[string]interface{}{}
+	for resp := range ch {
+		resps = append(resps, resp)
+	}
+	assert.Equal(t, 1, len(resps))
+	assert.Nil(t, mock.HandledErr())
+	assert.Nil(t, c.Close())
+}
+
+func TestTriageLastError(t *testing.T) {
+	triageSteps := func(value string) []step {
+		return []step{
+			{
+				expected: map[string]bencode.Datum{
+					"op":      "clone",
+					"id":      EXEC_ID,
+					"session": SESSION_ID,
+				},
+				responses: []map[string]bencode.Datum{
+					{"id": EXEC_ID, "new-session": "5678", "status": []bencode.Datum{"done"}},
+				},
+			},
+			{
+				expected: map[string]bencode.Datum{
+					"op":      "eval",
+					"id":      EXEC_ID,
+					"session": "5678",
+					"code":    triageCode,
+				},
+				responses: []map[string]bencode.Datum{
+					{"id": EXEC_ID, "value": value, "ns": "user"},
+					{"id": EXEC_ID, "status": []bencode.Datum{"done"}},
+				},
+			},
+			{
+				expected: map[string]bencode.Datum{
+					"op":      "close",
+					"id":      EXEC_ID,
+					"session": "5678",
+				},
+				responses: []map[string]bencode.Datum{
+					{"id": EXEC_ID, "status": []bencode.Datum{"done", "session-closed"}},
+				},
+			},
+		}
+	}
+	steps := append(
+		triageSteps(`{:class "clojure.lang.ExceptionInfo", :phase "compile-syntax-check", :source "NO_SOURCE_PATH", :line 1, :column 2}`),
+		triageSteps("nil")...,
+	)
+	mock := setupMock(steps, false)
+	c, err := setupClient(mock)
+	assert.Nil(t, err)
+	details, err := c.TriageLastError()
+	assert.Nil(t, err)
+	assert.Equal(t, &client.ErrorDetails{
+		Class:  "clojure.lang.ExceptionInfo",
+		Phase:  "compile-syntax-check",
+		Source: "NO_SOURCE_PATH",
+		Line:   1,
+		Column: 2,
+	}, details)
+	assert.True(t, details.IsSyntaxError())
+	details, err = c.TriageLastError()
+	assert.Nil(t, err)
+	assert.Nil(t, details)
+	assert.Nil(t, mock.HandledErr())
+	assert.Nil(t, c.Close())
+}
+
+func TestTriageLastErrorCloneFailure(t *testing.T) {
+	steps := []step{
+		{
+			expected: map[string]bencode.Datum{
+				"op":      "clone",
+				"id":      EXEC_ID,
+				"session": SESSION_ID,
+			},
+			responses: []map[string]bencode.Datum{
+				{"id": EXEC_ID, "status": []bencode.Datum{"error", "done"}},
+			},
+		},
+	}
+	mock := setupMock(steps, false)
+	c, err := setupClient(mock)
+	assert.Nil(t, err)
+	details, err := c.TriageLastError()
+	assert.EqualError(t, err, "failed to clone the session")
+	assert.Nil(t, details)
+	assert.Nil(t, c.Close())
+}
+
+func TestSendOp(t *testing.T) {
+	steps := []step{
+		{
+			expected: map[string]bencode.Datum{
+				"op":    "test",
+				"ns":    "foo.core-test",
+				"tests": []bencode.Datum{"bar-test"},
+			},
+			responses: []map[string]bencode.Datum{
+				{"out": "testing\n"},
+				{"summary": map[string]bencode.Datum{"test": 1, "pass": 1}},
+				{"status": []bencode.Datum{"done"}},
+			},
+		},
+	}
+	mock := setupMock(steps, true)
+	c, err := setupClient(mock)
+	assert.Nil(t, err)
+	resps := []map[string]interface{}{}
+	for resp := range c.SendOp(map[string]interface{}{
+		"op":    "test",
+		"ns":    "foo.core-test",
+		"tests": []bencode.Datum{"bar-test"},
+	}) {
+		delete(resp, "id")
+		delete(resp, "session")
+		resps = append(resps, resp)
+	}
+	assert.Equal(t, []map[string]interface{}{
+		{"out": "testing\n"},
+		{"summary": map[string]bencode.Datum{"test": 1, "pass": 1}},
+		{"status": []bencode.Datum{"done"}},
+	}, resps)
+	assert.Equal(t, []string{"testing\n"}, mock.Outs())
+	assert.Nil(t, mock.HandledErr())
+	assert.Nil(t, c.Close())
+}
@@ -0,0 +1,81 @@
+package nrepl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/athos/trenchman/client"
+	"olympos.io/encoding/edn"
+)
+
+// triageCode returns the summary of *e in the session by clojure.main/ex-triage,
+// which is resolved dynamically since it's only available in Clojure 1.10+.
+const triageCode = `(when-let [triage (and *e (resolve 'clojure.main/ex-triage))]` +
+	` (let [t (triage (Throwable->map *e))]` +
+	` (into {} (remove (comp nil? val))` +
+	` {:class (some-> (:clojure.error/class t) str)` +
+	` :phase (some-> (:clojure.error/phase t) name)` +
+	` :source (:clojure.error/source t)` +
+	` :line (:clojure.error/line t)` +
+	` :column (:clojure.error/column t)})))`
+
+type triageData struct {
+	Class  string `edn:"class"`
+	Phase  string `edn:"phase"`
+	Source string `edn:"source"`
+	Line   int    `edn:"line"`
+	Column int    `edn:"column"`
+}
+
+// TriageLastError retrieves the details of the last evaluation error in
+// the session. It returns nil if no details are available.
+//
+// The triage code is evaluated in a clone of the session, which inherits
+// *e, so that *1, *2 and *3 in the session are left intact.
+func (c *Client) TriageLastError() (*client.ErrorDetails, error) {
+	session := c.Session()
+	if session == "" {
+		// *e is not retained without a session
+		return nil, nil
+	}
+	clone := ""
+	for resp := range c.SendOp(map[string]interface{}{"op": "clone", "session": session}) {
+		if s, ok := resp["new-session"].(string); ok {
+			clone = s
+		}
+	}
+	if clone == "" {
+		return nil, errors.New("failed to clone the session")
+	}
+	defer func() {
+		for range c.SendOp(map[string]interface{}{"op": "close", "session": clone}) {
+		}
+	}()
+	var value string
+	var err error
+	for resp := range c.SendOp(map[string]interface{}{"op": "eval", "code": triageCode, "session": clone}) {
+		if v, ok := resp["value"].(string); ok {
+			value = v
+		}
+		if ex, ok := resp["ex"].(string); ok && err == nil {
+			err = client.NewRuntimeError(ex)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if value == "" || value == "nil" {
+		return nil, nil
+	}
+	var data triageData
+	if err := edn.UnmarshalString(value, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse triage data (%w)", err)
+	}
+	return &client.ErrorDetails{
+		Class:  data.Class,
+		Phase:  data.Phase,
+		Source: data.Source,
+		Line:   data.Line,
+		Column: data.Column,
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/athos/trenchman/client"
 	"olympos.io/encoding/edn"
 )
 
@@ -54,22 +55,18 @@ func exTriage(ex *Exception) *TriageData {
 	}
 	switch phase {
 	case "read-source":
-		if source != "" &&
-			source != "NO_SOURCE_FILE" &&
-			source != "NO_SOURCE_PATH" {
+		if hasSource(source) {
 			td.source = filepath.Base(source)
-			td.path = filepath.Dir(source)
+			td.path = source
 		}
 		if msg != "" {
 			td.cause = msg
 		}
 	case "compile-syntax-check", "compilation", "macro-syntax-check", "macroexpansion":
-		mergeToTriageData(td, topData)
-		if source != "" &&
-			source != "NO_SOURCE_FILE" &&
-			source != "NO_SOURCE_PATH" {
+		mergeToTriageData(&td, topData)
+		if hasSource(source) {
 			td.source = filepath.Base(source)
-			td.path = filepath.Dir(source)
+			td.path = source
 		}
 		if typ != "" {
 			td.class = typ
@@ -78,7 +75,7 @@ func exTriage(ex *Exception) *TriageData {
 			td.cause = msg
 		}
 	case "read-eval-result", "print-eval-result":
-		mergeToTriageData(td, topData)
+		mergeToTriageData(&td, topData)
 		if len(ex.Trace) > 0 {
 			source, method, file, line := coerceTraceEntry(ex.Trace[0])
 			if line != 0 {
@@ -105,14 +102,20 @@ func exTriage(ex *Exception) *TriageData {
 		source, method, file, line, found := findFirstNonCoreEntry(ex.Trace)
 		if found {
 			td.symbol = javaLocToSource(source, method)
-			td.source = file
+			if hasSource(file) {
+				td.source = file
+			}
 			td.line = line
 		}
 	}
 	return &td
 }
 
-func mergeToTriageData(td TriageData, data map[edn.Keyword]interface{}) {
+func hasSource(source string) bool {
+	return source != "" && source != "NO_SOURCE_FILE" && source != "NO_SOURCE_PATH"
+}
+
+func mergeToTriageData(td *TriageData, data map[edn.Keyword]interface{}) {
 	if data == nil {
 		return
 	}
@@ -144,27 +147,66 @@ func coerceTraceEntry(entry []interface{}) (string, string, string, int) {
 func findFirstNonCoreEntry(trace [][]interface{}) (string, string, string, int, bool) {
 	for _, entry := range trace {
 		source, method, file, line := coerceTraceEntry(entry)
-		if isCoreClass(source) {
+		if !isCoreClass(source) {
 			return source, method, file, line, true
 		}
 	}
 	return "", "", "", 0, false
 }
 
+// javaLocToSource converts a stack trace entry to the var name it comes
+// from (e.g. user$foo invokeStatic -> user/foo), like clojure.main does.
 func javaLocToSource(class, method string) string {
+	if method == "invoke" || method == "invokeStatic" {
+		return demunge(class)
+	}
 	return class + "/" + method
 }
 
+var demungeReplacer = strings.NewReplacer(
+	"_PLUS_", "+",
+	"_GT_", ">",
+	"_LT_", "<",
+	"_EQ_", "=",
+	"_TILDE_", "~",
+	"_BANG_", "!",
+	"_CIRCA_", "@",
+	"_SHARP_", "#",
+	"_SINGLEQUOTE_", "'",
+	"_DOUBLEQUOTE_", "\"",
+	"_PERCENT_", "%",
+	"_CARET_", "^",
+	"_AMPERSAND_", "&",
+	"_STAR_", "*",
+	"_BAR_", "|",
+	"_LBRACE_", "{",
+	"_RBRACE_", "}",
+	"_LBRACK_", "[",
+	"_RBRACK_", "]",
+	"_SLASH_", "/",
+	"_BSLASH_", "\\",
+	"_QMARK_", "?",
+	"_COLON_", ":",
+	"_", "-",
+	"$", "/",
+)
+
+// demunge restores the Clojure name from the munged class name, as
+// clojure.lang.Compiler/demunge does.
+func demunge(className string) string {
+	return demungeReplacer.Replace(className)
+}
+
 func isCoreClass(className string) bool {
-	return strings.HasPrefix(className, "clojure.")
+	return strings.HasPrefix(className, "clojure.lang.") ||
+		strings.HasPrefix(className, "clojure.core$")
 }
 
 func exString(td *TriageData) string {
 	source := "REPL"
 	if td.path != "" {
 		source = td.path
-	}
-	if td.source != "" {
+	} else if td.source != "" {
 		source = td.source
 	}
 	line := td.line
@@ -250,10 +292,21 @@ func exString(td *TriageData) string {
 	return ""
 }
 
-func errorMessage(payload string) (string, error) {
+func (td *TriageData) details() *client.ErrorDetails {
+	return &client.ErrorDetails{
+		Class:  td.class,
+		Phase:  td.phase,
+		Source: td.source,
+		Line:   td.line,
+		Column: td.column,
+	}
+}
+
+func runtimeError(payload string) *client.RuntimeError {
 	var ex Exception
 	if err := edn.UnmarshalString(payload, &ex); err != nil {
-		return "", fmt.Errorf("failed to parse exception data (%w)", err)
+		return client.NewRuntimeError(fmt.Sprintf("failed to parse exception data (%s)", err))
 	}
-	return exString(exTriage(&ex)), nil
+	td := exTriage(&ex)
+	return client.NewRuntimeErrorWithDetails(exString(td), td.details())
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"path/filepath"
 	"strings"
 	"sync"
 
@@ -143,12 +144,11 @@ func (c *Client) handleResult(resp *Response) {
 	c.ns = resp.Ns
 	c.lock.Unlock()
 	if resp.Exception {
-		msg, err := errorMessage(resp.Val)
-		if err != nil {
-			msg = err.Error()
+		err := runtimeError(resp.Val)
+		if !client.ReportsExceptions(c.outputHandler) {
+			c.outputHandler.Err(err.Error() + "\n")
 		}
-		c.outputHandler.Err(msg + "\n")
-		ch <- client.NewRuntimeError(msg)
+		ch <- err
 	} else {
 		ch <- resp.Val
 	}
@@ -187,7 +187,14 @@ func (c *Client) Eval(code string) <-chan client.EvalResult {
 }
 
 func (c *Client) Load(filename string, content string) <-chan client.EvalResult {
-	return c.Eval(content)
+	if filename == "-" {
+		return c.Eval(content)
+	}
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		path = filename
+	}
+	return c.Eval(client.LoadFileCode(path, content))
 }
 
 func (c *Client) Stdin(input string) {
@@ -64,13 +64,16 @@ func TestEval(t *testing.T) {
 			client.Step{
 				Expected: "(do (/ 1 0))",
 				Responses: []string{
-					`{:tag :ret, :val "{:phase :execution, :cause \"Divide by zero\", :trace [[clojure.lang.Numbers divide \"Numbers.java\" 188]], :via [{:type java.lang.ArithmeticException, :message \"Divide by zero\", :at [clojure.lang.Numbers divide \"Numbers.java\" 188]}]}", :exception true, :ns "user"}`,
+					`{:tag :ret, :val "{:phase :execution, :cause \"Divide by zero\", :trace [[clojure.lang.Numbers divide \"Numbers.java\" 188] [user$eval1 invokeStatic \"NO_SOURCE_FILE\" 1]], :via [{:type java.lang.ArithmeticException, :message \"Divide by zero\", :at [clojure.lang.Numbers divide \"Numbers.java\" 188]}]}", :exception true, :ns "user"}`,
 				},
 			},
 			"user",
-			client.NewRuntimeError("Execution error (ArithmeticException) at clojure.lang.Numbers/divide (Numbers.java:188).\nDivide by zero"),
+			client.NewRuntimeErrorWithDetails(
+				"Execution error (ArithmeticException) at user/eval1 (REPL:1).\nDivide by zero",
+				&client.ErrorDetails{Class: "java.lang.ArithmeticException", Phase: "execution", Line: 1},
+			),
 			nil,
-			[]string{"Execution error (ArithmeticException) at clojure.lang.Numbers/divide (Numbers.java:188).\nDivide by zero\n"},
+			[]string{"Execution error (ArithmeticException) at user/eval1 (REPL:1).\nDivide by zero\n"},
 		},
 		{
 			"(run! prn (range 3))",
@@ -150,7 +153,7 @@ func TestEval(t *testing.T) {
 func TestLoad(t *testing.T) {
 	mock := setupMock([]client.Step{
 		{
-			Expected: "(do (println \"Hello, World!\"))",
+			Expected: `(do (clojure.lang.Compiler/load (java.io.StringReader. "(println \"Hello, World!\")") "/src/hello.clj" "hello.clj"))`,
 			Responses: []string{
 				"{:tag :out, :val \"Hello, World!\n\"}",
 				`{:tag :ret, :val "nil"}`,
@@ -159,7 +162,7 @@ func TestLoad(t *testing.T) {
 	})
 	c, err := setupClient(mock)
 	assert.Nil(t, err)
-	ch := c.Load("hello.clj", "(println \"Hello, World!\")")
+	ch := c.Load("/src/hello.clj", "(println \"Hello, World!\")")
 	ret := <-ch
 	assert.Equal(t, "nil", ret)
 	assert.Nil(t, mock.HandledErr())
@@ -167,3 +170,65 @@ func TestLoad(t *testing.T) {
 	assert.Nil(t, mock.Errs())
 	assert.Nil(t, c.Close())
 }
+
+func TestRuntimeError(t *testing.T) {
+	tests := []struct {
+		title    string
+		payload  string
+		message  string
+		expected *client.ErrorDetails
+	}{
+		{
+			"compile error in loaded file",
+			`{:phase :compile-syntax-check, :via [{:type clojure.lang.Compiler$CompilerException, :message "Syntax error compiling at (/src/foo/core.clj:3:1).", :data {:clojure.error/phase :compile-syntax-check, :clojure.error/line 3, :clojure.error/column 1, :clojure.error/source "/src/foo/core.clj"}} {:type java.lang.RuntimeException, :message "Unable to resolve symbol: x in this context"}], :trace []}`,
+			"Syntax error compiling at (/src/foo/core.clj:3:1).\nUnable to resolve symbol: x in this context",
+			&client.ErrorDetails{Class: "java.lang.RuntimeException", Phase: "compile-syntax-check", Source: "core.clj", Line: 3, Column: 1},
+		},
+		{
+			"execution error in loaded file",
+			`{:phase :execution, :via [{:type clojure.lang.ExceptionInfo, :message "boom"}], :trace [[clojure.core$ex_info invokeStatic "core.clj" 4617] [my_app.core$do_it_BANG_ invokeStatic "core.clj" 12] [my_app.core$do_it_BANG_ invoke "core.clj" 10]]}`,
+			"Execution error (ExceptionInfo) at my-app.core/do-it! (core.clj:12).\nboom",
+			&client.ErrorDetails{Class: "clojure.lang.ExceptionInfo", Phase: "execution", Source: "core.clj", Line: 12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			err := runtimeError(tt.payload)
+			assert.Equal(t, tt.message, err.Error())
+			assert.Equal(t, tt.expected, err.Details())
+		})
+	}
+}
+
+// exceptionReporter is an output handler reporting evaluation errors by
+// itself, as the REPL does in the JSON mode.
+type exceptionReporter struct {
+	*client.MockServer
+}
+
+func (r exceptionReporter) ReportsExceptions() bool {
+	return true
+}
+
+func TestEvalErrorReportedByHandler(t *testing.T) {
+	mock := setupMock([]client.Step{{
+		Expected: "(do (/ 1 0))",
+		Responses: []string{
+			`{:tag :ret, :val "{:phase :execution, :cause \"Divide by zero\", :via [{:type java.lang.ArithmeticException, :message \"Divide by zero\"}]}", :exception true, :ns "user"}`,
+		},
+	}})
+	c, err := NewClient(&Opts{
+		ConnBuilder: client.ConnBuilderFunc(func() (net.Conn, error) {
+			return mock, nil
+		}),
+		OutputHandler: exceptionReporter{mock},
+		ErrorHandler:  mock,
+	})
+	assert.Nil(t, err)
+	ret := <-c.Eval("(/ 1 0)")
+	_, ok := ret.(*client.RuntimeError)
+	assert.True(t, ok)
+	assert.Nil(t, mock.HandledErr())
+	assert.Nil(t, mock.Errs())
+	assert.Nil(t, c.Close())
+}
@@ -0,0 +1,284 @@
+// Package reader implements a lightweight reader for Clojure code, which is
+// enough to find the boundaries of forms and to look into simple forms such
+// as ns forms without evaluating anything.
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type (
+	// Symbol is a symbol. Other tokens, such as numbers, are also read as
+	// symbols.
+	Symbol  string
+	Keyword string
+	List    []interface{}
+	Vector  []interface{}
+	Map     []interface{}
+
+	// Skipped stands for a form whose value the reader does not yield,
+	// e.g. a tagged literal or a reader conditional without a :clj branch.
+	// Skipped forms are dropped from collections.
+	Skipped struct{}
+
+	Reader struct {
+		cs  []rune
+		pos int
+		eof bool
+	}
+)
+
+// ErrIncomplete means that more input is needed to complete the form.
+var ErrIncomplete = errors.New("incomplete form")
+
+// NewReader returns a reader reading forms from the runes. If eof is false,
+// the input is considered to continue, so a token at the end of the input
+// is incomplete.
+func NewReader(cs []rune, eof bool) *Reader {
+	return &Reader{cs: cs, eof: eof}
+}
+
+// Pos returns the position of the next rune to read.
+func (r *Reader) Pos() int {
+	return r.pos
+}
+
+// AtEnd reports whether the reader has consumed all the input.
+func (r *Reader) AtEnd() bool {
+	return r.pos >= len(r.cs)
+}
+
+// IsTerminator reports whether the rune terminates a token.
+func IsTerminator(c rune) bool {
+	return c == ',' || unicode.IsSpace(c) || strings.ContainsRune("\";@^`~()[]{}\\", c)
+}
+
+func (r *Reader) peek() (rune, error) {
+	if r.pos >= len(r.cs) {
+		return 0, ErrIncomplete
+	}
+	return r.cs[r.pos], nil
+}
+
+func (r *Reader) next() (rune, error) {
+	c, err := r.peek()
+	if err == nil {
+		r.pos++
+	}
+	return c, err
+}
+
+// SkipSpaces skips whitespaces, commas, comments and shebang lines.
+func (r *Reader) SkipSpaces() {
+	for r.pos < len(r.cs) {
+		c := r.cs[r.pos]
+		switch {
+		case c == ';' || (c == '#' && r.pos+1 < len(r.cs) && r.cs[r.pos+1] == '!'):
+			for r.pos < len(r.cs) && r.cs[r.pos] != '\n' {
+				r.pos++
+			}
+		case c == ',' || unicode.IsSpace(c):
+			r.pos++
+		default:
+			return
+		}
+	}
+}
+
+// readToken reads a symbol, keyword, number or the rest of a character
+// literal. A token at the end of the input is complete only at EOF.
+func (r *Reader) readToken() (string, error) {
+	start := r.pos
+	for r.pos < len(r.cs) && !IsTerminator(r.cs[r.pos]) {
+		r.pos++
+	}
+	if r.pos == len(r.cs) && !r.eof {
+		return "", ErrIncomplete
+	}
+	return string(r.cs[start:r.pos]), nil
+}
+
+func (r *Reader) readString() (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := r.next()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if c, err = r.next(); err != nil {
+				return "", err
+			}
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func (r *Reader) readSeq(closer rune) ([]interface{}, error) {
+	ret := []interface{}{}
+	for {
+		r.SkipSpaces()
+		c, err := r.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == closer {
+			r.pos++
+			return ret, nil
+		}
+		form, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := form.(Skipped); !ok {
+			ret = append(ret, form)
+		}
+	}
+}
+
+// Read reads the next form. Only lists, vectors, maps, strings, symbols and
+// keywords are yielded as values, and the other forms are read just to be
+// skipped. Reader macros, such as quotes and metadata, are read together
+// with the form they are attached to.
+func (r *Reader) Read() (interface{}, error) {
+	r.SkipSpaces()
+	c, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case '(':
+		forms, err := r.readSeq(')')
+		return List(forms), err
+	case '[':
+		forms, err := r.readSeq(']')
+		return Vector(forms), err
+	case '{':
+		forms, err := r.readSeq('}')
+		return Map(forms), err
+	case ')', ']', '}':
+		return nil, fmt.Errorf("unbalanced symbol found: %c", c)
+	case '"':
+		return r.readString()
+	case '\\':
+		if _, err := r.next(); err != nil {
+			return nil, err
+		}
+		if _, err := r.readToken(); err != nil {
+			return nil, err
+		}
+		return Skipped{}, nil
+	case '\'', '`', '@', '~':
+		if c == '~' && r.pos < len(r.cs) && r.cs[r.pos] == '@' {
+			r.pos++
+		}
+		return r.Read()
+	case '^':
+		// metadata followed by the form it is attached to
+		if _, err := r.Read(); err != nil {
+			return nil, err
+		}
+		return r.Read()
+	case '#':
+		return r.readDispatch()
+	}
+	r.pos--
+	token, err := r.readToken()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(token, ":") {
+		return Keyword(token[1:]), nil
+	}
+	return Symbol(token), nil
+}
+
+func (r *Reader) readDispatch() (interface{}, error) {
+	c, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case '(', '{':
+		r.pos--
+		if _, err := r.Read(); err != nil {
+			return nil, err
+		}
+		return Skipped{}, nil
+	case '"':
+		_, err := r.readString()
+		return Skipped{}, err
+	case '#':
+		// symbolic values
+		_, err := r.readToken()
+		return Skipped{}, err
+	case '\'', '=':
+		return r.Read()
+	case '^':
+		if _, err := r.Read(); err != nil {
+			return nil, err
+		}
+		return r.Read()
+	case '_':
+		return r.readDiscard()
+	case '?':
+		if r.pos < len(r.cs) && r.cs[r.pos] == '@' {
+			r.pos++
+		}
+		return r.readConditional()
+	}
+	// tagged literals and namespaced maps
+	r.pos--
+	if _, err := r.readToken(); err != nil {
+		return nil, err
+	}
+	if _, err := r.Read(); err != nil {
+		return nil, err
+	}
+	return Skipped{}, nil
+}
+
+// readDiscard reads the discarded form and the form following it, unless
+// the discarded form is the last one in the collection or in the input.
+func (r *Reader) readDiscard() (interface{}, error) {
+	if _, err := r.Read(); err != nil {
+		return nil, err
+	}
+	r.SkipSpaces()
+	c, err := r.peek()
+	if err != nil {
+		if r.eof {
+			return Skipped{}, nil
+		}
+		return nil, err
+	}
+	if c == ')' || c == ']' || c == '}' {
+		return Skipped{}, nil
+	}
+	return r.Read()
+}
+
+// readConditional reads a reader conditional, taking the :clj branch or
+// the :default one.
+func (r *Reader) readConditional() (interface{}, error) {
+	form, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	branches, ok := form.(List)
+	if !ok {
+		return Skipped{}, nil
+	}
+	for i := 0; i+1 < len(branches); i += 2 {
+		if k, ok := branches[i].(Keyword); ok && (k == "clj" || k == "default") {
+			return branches[i+1], nil
+		}
+	}
+	return Skipped{}, nil
+}
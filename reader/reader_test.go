@@ -0,0 +1,59 @@
+package reader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"foo/bar", Symbol("foo/bar")},
+		{"42", Symbol("42")},
+		{":require", Keyword("require")},
+		{`"a \"b\""`, `a "b"`},
+		{"(a [b] {:c d})", List{Symbol("a"), Vector{Symbol("b")}, Map{Keyword("c"), Symbol("d")}}},
+		{"; comment\n, x", Symbol("x")},
+		{"'x", Symbol("x")},
+		{"`(~x ~@xs)", List{Symbol("x"), Symbol("xs")}},
+		{"^:private ^{:a 1} x", Symbol("x")},
+		{"#^:a x", Symbol("x")},
+		{"#'f", Symbol("f")},
+		{"#_ignored x", Symbol("x")},
+		{"(a #_b)", List{Symbol("a")}},
+		{"(a \\) #{1} #(inc %) #\"\\d+\" ##Inf #inst \"2022-01-01\" #:a{:b 1})", List{Symbol("a")}},
+		{"#?(:cljs a :clj b)", Symbol("b")},
+		{"#?(:cljs a :default c)", Symbol("c")},
+		{"#?(:cljs a)", Skipped{}},
+		{"[#?@(:clj [a b])]", Vector{Vector{Symbol("a"), Symbol("b")}}},
+	}
+	for _, tt := range tests {
+		form, err := NewReader([]rune(tt.input), true).Read()
+		assert.Nil(t, err, tt.input)
+		assert.Equal(t, tt.expected, form, tt.input)
+	}
+}
+
+func TestReadPos(t *testing.T) {
+	r := NewReader([]rune("  (a b) c"), true)
+	_, err := r.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 7, r.Pos())
+	_, err = r.Read()
+	assert.Nil(t, err)
+	assert.True(t, r.AtEnd())
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, input := range []string{"(a b", "\"abc", "#_", "^:a"} {
+		_, err := NewReader([]rune(input), true).Read()
+		assert.Equal(t, ErrIncomplete, err, input)
+	}
+	_, err := NewReader([]rune("abc"), false).Read()
+	assert.Equal(t, ErrIncomplete, err)
+	_, err = NewReader([]rune(")"), true).Read()
+	assert.EqualError(t, err, "unbalanced symbol found: )")
+}
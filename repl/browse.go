@@ -0,0 +1,216 @@
+package repl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+	"github.com/fatih/color"
+	"olympos.io/encoding/edn"
+)
+
+const namespacesCode = `(binding [` + client.PrintBindings + `]` +
+	` (pr-str (sort (map (comp str ns-name) (all-ns)))))`
+
+const varsCode = `(binding [` + client.PrintBindings + `]` +
+	` (pr-str (when-let [ns (find-ns '%s)]` +
+	` (for [[s v] (sort-by key (ns-publics ns)) :let [m (meta v)]]` +
+	` {:name (str s) :arglists (some-> (:arglists m) pr-str) :doc (:doc m)}))))`
+
+const aproposCode = `(binding [` + client.PrintBindings + `]` +
+	` (pr-str (let [re (re-pattern %s)]` +
+	` (sort-by :name (for [ns (all-ns) [s v] (ns-publics ns) :when (re-find re (str s))]` +
+	` {:name (str (ns-name ns) "/" s) :doc (:doc (meta v))})))))`
+
+// varSummary is a var listed by ,vars or ,apropos.
+type varSummary struct {
+	Name     string `edn:"name"`
+	Arglists string `edn:"arglists"`
+	Doc      string `edn:"doc"`
+}
+
+// aproposPattern returns the regex given as the argument of ,apropos,
+// either as a regex literal (#"..."), a string or a bare word.
+func aproposPattern(arg string) (string, error) {
+	if strings.HasPrefix(arg, `#"`) {
+		// regex literals don't unescape anything but \"
+		return strings.ReplaceAll(arg[2:len(arg)-1], `\"`, `"`), nil
+	}
+	if strings.HasPrefix(arg, `"`) {
+		var s string
+		if err := edn.UnmarshalString(arg, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	return arg, nil
+}
+
+func firstLine(doc string) string {
+	doc = strings.TrimSpace(doc)
+	if i := strings.IndexByte(doc, '\n'); i >= 0 {
+		doc = doc[:i]
+	}
+	return strings.TrimSpace(doc)
+}
+
+// evalEDN evaluates the code returning an EDN string, and unmarshals it.
+func (r *Repl) evalEDN(code string, v interface{}) error {
+	value, err := r.evalForCommand(code)
+	if err != nil {
+		return err
+	}
+	var s string
+	if err = edn.UnmarshalString(value, &s); err == nil {
+		err = edn.UnmarshalString(s, v)
+	}
+	if err != nil {
+		r.commandError("Failed to parse the results: %s", value)
+		return fmt.Errorf("failed to parse the results (%w)", err)
+	}
+	return nil
+}
+
+// evalString evaluates the code returning a string, and returns the string,
+// or "" if the value is nil.
+func (r *Repl) evalString(code string) (string, error) {
+	value, err := r.evalForCommand(code)
+	if err != nil || value == "nil" {
+		return "", err
+	}
+	var s string
+	if err := edn.UnmarshalString(value, &s); err != nil {
+		r.commandError("Failed to parse the results: %s", value)
+		return "", fmt.Errorf("failed to parse the results (%w)", err)
+	}
+	return s, nil
+}
+
+func datumStrings(d bencode.Datum) []string {
+	list, _ := d.([]bencode.Datum)
+	ret := []string{}
+	for _, x := range list {
+		if s, ok := x.(string); ok {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// unquote reads the value printed by pr-str, as cider-nrepl returns the
+// metadata of vars.
+func unquote(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		var ret string
+		if err := edn.UnmarshalString(s, &ret); err == nil {
+			return ret
+		}
+	}
+	if s == "nil" {
+		return ""
+	}
+	return s
+}
+
+// Namespaces lists the namespaces loaded on the server.
+func (r *Repl) Namespaces() error {
+	var nss []string
+	if resps, ok := r.tryOp(map[string]interface{}{"op": "ns-list"}); ok {
+		for _, resp := range resps {
+			nss = append(nss, datumStrings(resp["ns-list"])...)
+		}
+		sort.Strings(nss)
+	} else if err := r.evalEDN(namespacesCode, &nss); err != nil {
+		return err
+	}
+	out := r.reportWriter()
+	for _, ns := range nss {
+		fmt.Fprintln(out, ns)
+	}
+	return nil
+}
+
+func (r *Repl) nsVars(ns string) ([]varSummary, error) {
+	if resps, ok := r.tryOp(map[string]interface{}{"op": "ns-vars-with-meta", "ns": ns}); ok {
+		var vars []varSummary
+		for _, resp := range resps {
+			metas, ok := resp["ns-vars-with-meta"].(map[string]bencode.Datum)
+			if !ok {
+				continue
+			}
+			if vars == nil {
+				vars = []varSummary{}
+			}
+			for name, m := range metas {
+				meta, _ := m.(map[string]bencode.Datum)
+				arglists, _ := meta["arglists"].(string)
+				doc, _ := meta["doc"].(string)
+				vars = append(vars, varSummary{name, unquote(arglists), unquote(doc)})
+			}
+		}
+		sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+		return vars, nil
+	}
+	var vars []varSummary
+	if err := r.evalEDN(fmt.Sprintf(varsCode, ns), &vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// Vars lists the public vars of the namespace with their arglists and the
+// first lines of their docstrings.
+func (r *Repl) Vars(ns string) error {
+	vars, err := r.nsVars(ns)
+	if err != nil {
+		return err
+	}
+	if vars == nil {
+		r.commandError("Namespace not found: %s", ns)
+		return fmt.Errorf("namespace not found: %s", ns)
+	}
+	r.printVars(vars)
+	return nil
+}
+
+func (r *Repl) printVars(vars []varSummary) {
+	out := r.reportWriter()
+	for _, v := range vars {
+		r.printer.With(color.FgCyan).Fprint(out, v.Name)
+		if v.Arglists != "" {
+			fmt.Fprint(out, "  ")
+			r.printer.With(color.FgYellow).Fprint(out, v.Arglists)
+		}
+		fmt.Fprintln(out)
+		if doc := firstLine(v.Doc); doc != "" {
+			fmt.Fprintf(out, "  %s\n", doc)
+		}
+	}
+}
+
+// Apropos lists the public vars in all the namespaces whose names match
+// the regex.
+func (r *Repl) Apropos(pattern string) error {
+	var vars []varSummary
+	if resps, ok := r.tryOp(map[string]interface{}{"op": "apropos", "query": pattern}); ok {
+		for _, resp := range resps {
+			matches, _ := resp["apropos-matches"].([]bencode.Datum)
+			for _, m := range matches {
+				m, _ := m.(map[string]bencode.Datum)
+				name, _ := m["name"].(string)
+				doc, _ := m["doc"].(string)
+				vars = append(vars, varSummary{Name: name, Doc: doc})
+			}
+		}
+	} else if err := r.evalEDN(fmt.Sprintf(aproposCode, client.QuoteString(pattern)), &vars); err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		fmt.Fprintf(r.reportWriter(), "No vars found matching %s\n", pattern)
+		return nil
+	}
+	r.printVars(vars)
+	return nil
+}
@@ -0,0 +1,93 @@
+package repl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAproposPattern(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected string
+	}{
+		{"^re-", "^re-"},
+		{`#"^re-\d"`, `^re-\d`},
+		{`#"\"quoted\""`, `"quoted"`},
+		{`"^re-\\d"`, `^re-\d`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			pattern, err := aproposPattern(tt.arg)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, pattern)
+		})
+	}
+}
+
+func TestBrowseWithOps(t *testing.T) {
+	repl, c := setupOpRepl(map[string][]map[string]interface{}{
+		"ns-list": {{"ns-list": []bencode.Datum{"user", "clojure.string", "clojure.core"}}},
+		"ns-vars-with-meta": {{"ns-vars-with-meta": map[string]bencode.Datum{
+			"upper-case": map[string]bencode.Datum{"arglists": "([s])", "doc": `"Converts string to all upper-case."`},
+			"blank?":     map[string]bencode.Datum{"arglists": "([s])", "doc": "\"True if s is nil, empty,\n  or contains only whitespace.\""},
+		}}},
+		"apropos": {{"apropos-matches": []bencode.Datum{
+			map[string]bencode.Datum{"name": "clojure.core/re-find", "type": "function", "doc": "Returns the next regex match."},
+		}}},
+	})
+	assert.Nil(t, repl.Namespaces())
+	assert.Equal(t, "clojure.core\nclojure.string\nuser\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.Nil(t, repl.Vars("clojure.string"))
+	assert.Equal(t, map[string]interface{}{"op": "ns-vars-with-meta", "ns": "clojure.string"}, c.reqs[len(c.reqs)-1])
+	expected := "blank?  ([s])\n" +
+		"  True if s is nil, empty,\n" +
+		"upper-case  ([s])\n" +
+		"  Converts string to all upper-case.\n"
+	assert.Equal(t, expected, c.outs.String())
+
+	c.outs.Reset()
+	assert.Nil(t, repl.Apropos("^re-f"))
+	assert.Equal(t, map[string]interface{}{"op": "apropos", "query": "^re-f"}, c.reqs[len(c.reqs)-1])
+	assert.Equal(t, "clojure.core/re-find\n  Returns the next regex match.\n", c.outs.String())
+
+	c.resps["ns-vars-with-meta"] = []map[string]interface{}{{"status": []bencode.Datum{"done", "namespace-not-found"}}}
+	c.outs.Reset()
+	assert.NotNil(t, repl.Vars("nonexistent"))
+	assert.Equal(t, "Namespace not found: nonexistent\n", c.outs.String())
+}
+
+func TestBrowseByEval(t *testing.T) {
+	c := newMockClient(step{namespacesCode, func(ch chan<- client.EvalResult) {
+		ch <- `"(\"clojure.core\" \"user\")"`
+	}})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	assert.Nil(t, repl.Namespaces())
+	assert.Equal(t, "clojure.core\nuser\n", c.outs.String())
+
+	c.step = step{fmt.Sprintf(varsCode, "user"), func(ch chan<- client.EvalResult) {
+		ch <- `"({:name \"f\", :arglists \"([x])\", :doc \"Does f.\"} {:name \"x\"})"`
+	}}
+	c.outs.Reset()
+	assert.Nil(t, repl.RunCommand("vars", ""))
+	assert.Equal(t, "f  ([x])\n  Does f.\nx\n", c.outs.String())
+
+	c.step = step{fmt.Sprintf(varsCode, "nonexistent"), func(ch chan<- client.EvalResult) {
+		ch <- `"nil"`
+	}}
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("vars", "nonexistent"))
+	assert.Equal(t, "Namespace not found: nonexistent\n", c.outs.String())
+
+	c.step = step{fmt.Sprintf(aproposCode, `"^zzz"`), func(ch chan<- client.EvalResult) {
+		ch <- `"()"`
+	}}
+	c.outs.Reset()
+	assert.Nil(t, repl.RunCommand("apropos", `#"^zzz"`))
+	assert.Equal(t, "No vars found matching ^zzz\n", c.outs.String())
+}
@@ -0,0 +1,209 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// DefaultCommandPrefix is the prefix of the inputs invoking REPL commands
+// unless specified otherwise. Since commas are whitespace in Clojure, no
+// Clojure code starts with it.
+const DefaultCommandPrefix = ","
+
+type (
+	// Command is a REPL command, invoked by an input starting with the
+	// command prefix followed by the name of the command, e.g. ",doc map".
+	Command struct {
+		Name string
+		// Usage describes the arguments, e.g. "SYMBOL" or "[N]".
+		Usage string
+		Help  string
+		// MinArgs and MaxArgs are the numbers of the forms accepted as the
+		// arguments. MaxArgs < 0 means no limit.
+		MinArgs int
+		MaxArgs int
+		Run     func(r *Repl, args *CommandArgs) error
+	}
+
+	CommandArgs struct {
+		// Raw is the input following the command name.
+		Raw string
+		// Forms are the forms read from Raw.
+		Forms []string
+	}
+)
+
+// errQuit is returned by the quit command to stop the REPL.
+var errQuit = errors.New("quit")
+
+var builtinCommands []*Command
+
+func (r *Repl) prefix() string {
+	if r.commandPrefix == "" {
+		return DefaultCommandPrefix
+	}
+	return r.commandPrefix
+}
+
+// parseCommand splits the input into the command name and the rest if the
+// input starts with the command prefix.
+func (r *Repl) parseCommand(input string) (name, rest string, ok bool) {
+	if !strings.HasPrefix(input, r.prefix()) {
+		return "", "", false
+	}
+	s := strings.TrimPrefix(input, r.prefix())
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", "", false
+	}
+	return s[:end], strings.TrimSpace(s[end:]), true
+}
+
+// lookupCommand finds the command by name. User-defined commands take
+// precedence over the built-in ones.
+func (r *Repl) lookupCommand(name string) *Command {
+	for _, cmd := range r.commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	for _, cmd := range builtinCommands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// allCommands returns the commands available, sorted by name.
+func (r *Repl) allCommands() []*Command {
+	ret := append([]*Command{}, r.commands...)
+	for _, cmd := range builtinCommands {
+		if !containsCommand(ret, cmd.Name) {
+			ret = append(ret, cmd)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func containsCommand(cmds []*Command, name string) bool {
+	for _, cmd := range cmds {
+		if cmd.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repl) commandUsage(cmd *Command) string {
+	if cmd.Usage == "" {
+		return r.prefix() + cmd.Name
+	}
+	return r.prefix() + cmd.Name + " " + cmd.Usage
+}
+
+func (r *Repl) commandError(format string, args ...interface{}) {
+	r.printer.With(color.FgRed).Fprintf(r.reportWriter(), format+"\n", args...)
+}
+
+// RunCommand runs the command with the arguments.
+func (r *Repl) RunCommand(name, rawArgs string) error {
+	cmd := r.lookupCommand(name)
+	if cmd == nil {
+		err := fmt.Errorf("unknown command: %s%s", r.prefix(), name)
+		r.commandError("Unknown command: %s%s (type %shelp for the list of commands)", r.prefix(), name, r.prefix())
+		return err
+	}
+	forms, err := splitForms(rawArgs)
+	if err != nil {
+		r.commandError("Syntax error reading arguments (%s)", err)
+		return err
+	}
+	if len(forms) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(forms) > cmd.MaxArgs) {
+		err := fmt.Errorf("wrong number of arguments to %s%s", r.prefix(), name)
+		r.commandError("Usage: %s", r.commandUsage(cmd))
+		return err
+	}
+	return cmd.Run(r, &CommandArgs{Raw: rawArgs, Forms: forms})
+}
+
+// splitForms reads the top-level forms in the string.
+func splitForms(s string) ([]string, error) {
+	buf := &formBuffer{}
+	forms, err := buf.feed(s)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := buf.flush()
+	if err != nil {
+		return nil, err
+	}
+	return append(forms, rest...), nil
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{\{(args|ns|[1-9])\}\}`)
+
+// TemplateCommand creates a command that evaluates the code template. In
+// the template, {{args}} is replaced with the whole arguments, {{1}} to
+// {{9}} with the corresponding argument forms, and {{ns}} with the current
+// namespace.
+func TemplateCommand(name, template, help string) *Command {
+	minArgs := 0
+	for _, m := range placeholderRegexp.FindAllStringSubmatch(template, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > minArgs {
+			minArgs = n
+		}
+	}
+	usage := ""
+	if strings.Contains(template, "{{args}}") {
+		usage = "ARGS..."
+	} else if minArgs > 0 {
+		args := make([]string, minArgs)
+		for i := range args {
+			args[i] = fmt.Sprintf("ARG%d", i+1)
+		}
+		usage = strings.Join(args, " ")
+	}
+	maxArgs := minArgs
+	if strings.Contains(template, "{{args}}") {
+		maxArgs = -1
+	}
+	return &Command{
+		Name:    name,
+		Usage:   usage,
+		Help:    help,
+		MinArgs: minArgs,
+		MaxArgs: maxArgs,
+		Run: func(r *Repl, args *CommandArgs) error {
+			return r.Eval(expandTemplate(template, args, r.currentClient().CurrentNS()))
+		},
+	}
+}
+
+func expandTemplate(template string, args *CommandArgs, ns string) string {
+	return placeholderRegexp.ReplaceAllStringFunc(template, func(s string) string {
+		switch key := s[2 : len(s)-2]; key {
+		case "args":
+			return args.Raw
+		case "ns":
+			return ns
+		default:
+			n, _ := strconv.Atoi(key)
+			if n <= len(args.Forms) {
+				return args.Forms[n-1]
+			}
+			return ""
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package repl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/athos/trenchman/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		prefix string
+		input  string
+		name   string
+		rest   string
+		ok     bool
+	}{
+		{"", ",doc map", "doc", "map", true},
+		{",", ",help", "help", "", true},
+		{",", ",time  (reduce + (range 10)) ", "time", "(reduce + (range 10))", true},
+		{",", "(+ 1 2)", "", "", false},
+		{",", ",", "", "", false},
+		{":repl/", ":repl/quit", "quit", "", true},
+		{":repl/", ",help", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r := &Repl{commandPrefix: tt.prefix}
+			name, rest, ok := r.parseCommand(tt.input)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.rest, rest)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	args := &CommandArgs{Raw: "foo (bar 1)", Forms: []string{"foo", "(bar 1)"}}
+	assert.Equal(t, "(tap> [foo (bar 1)])", expandTemplate("(tap> [{{args}}])", args, "user"))
+	assert.Equal(t, "(f (bar 1) foo '{{x}} 'user)", expandTemplate("(f {{2}} {{1}} '{{x}} '{{ns}})", args, "user"))
+	assert.Equal(t, "(f )", expandTemplate("(f {{3}})", args, "user"))
+}
+
+func TestTemplateCommand(t *testing.T) {
+	cmd := TemplateCommand("reset", "(user/reset)", "Reset the system.")
+	assert.Equal(t, "", cmd.Usage)
+	assert.Equal(t, 0, cmd.MaxArgs)
+
+	cmd = TemplateCommand("assoc", "(swap! state assoc {{1}} {{2}})", "")
+	assert.Equal(t, "ARG1 ARG2", cmd.Usage)
+	assert.Equal(t, 2, cmd.MinArgs)
+	assert.Equal(t, 2, cmd.MaxArgs)
+
+	cmd = TemplateCommand("tap", "(tap> [{{1}} {{args}}])", "")
+	assert.Equal(t, "ARGS...", cmd.Usage)
+	assert.Equal(t, 1, cmd.MinArgs)
+	assert.Equal(t, -1, cmd.MaxArgs)
+}
+
+func TestRunCommand(t *testing.T) {
+	c := newMockClient(step{"(user/reset)", func(ch chan<- client.EvalResult) {
+		ch <- ":reset"
+	}})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	repl.commands = []*Command{
+		TemplateCommand("reset", "(user/reset)", "Reset the system."),
+		TemplateCommand("history", "(my/history)", "Shadows the built-in one."),
+	}
+
+	assert.Nil(t, repl.RunCommand("reset", ""))
+	assert.Equal(t, ":reset\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("reset", "extra"))
+	assert.Equal(t, "Usage: ,reset\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("doc", ""))
+	assert.Equal(t, "Usage: ,doc SYMBOL\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("nonexistent", ""))
+	assert.Equal(t, "Unknown command: ,nonexistent (type ,help for the list of commands)\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("time", "(foo"))
+	assert.Contains(t, c.outs.String(), "Syntax error reading arguments")
+
+	c.outs.Reset()
+	assert.Nil(t, repl.RunCommand("help", "history"))
+	assert.Equal(t, ",history\n  Shadows the built-in one.\n", c.outs.String())
+
+	c.step = step{fmt.Sprintf(lookupCode, "nonexistent"), func(ch chan<- client.EvalResult) {
+		ch <- `"nil"`
+	}}
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("doc", "nonexistent"))
+	assert.Equal(t, "No documentation found for nonexistent\n", c.outs.String())
+
+	assert.Equal(t, errQuit, repl.RunCommand("quit", ""))
+}
+
+func TestHistoryCommand(t *testing.T) {
+	c := newMockClient(step{})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	repl.history = []*historyEntry{
+		{Code: "(+ 1 2)", Value: "3"},
+		{Code: "(def x 42)", Value: "#'user/x"},
+		{Code: "(/ x 0)", Err: "Divide by zero"},
+	}
+	assert.Nil(t, repl.RunCommand("history", "2"))
+	assert.Equal(t, "   2  (def x 42)\n      => #'user/x\n   3  (/ x 0)\n      !! Divide by zero\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("history", "zero"))
+	assert.Equal(t, "N must be a positive integer: zero\n", c.outs.String())
+}
+
+func TestReplCommands(t *testing.T) {
+	in := make(chan string)
+	c := newMockClient(step{"(+ 1 2)", func(ch chan<- client.EvalResult) {
+		ch <- "3"
+	}})
+	repl := setupRepl(newMockReader(in), c)
+	done := make(chan struct{})
+	go func() {
+		repl.Start()
+		close(done)
+	}()
+	in <- "(+ 1 2)\n"
+	in <- ",history\n"
+	in <- ",quit\n"
+	<-done
+	assert.Equal(t, "user=> 3\nuser=>    1  (+ 1 2)\n      => 3\nuser=> ", c.outs.String())
+}
@@ -0,0 +1,328 @@
+package repl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+	"github.com/fatih/color"
+)
+
+func init() {
+	builtinCommands = []*Command{
+		{
+			Name:    "help",
+			Usage:   "[COMMAND]",
+			Help:    "Show the list of commands, or the help for a command.",
+			MaxArgs: 1,
+			Run:     runHelp,
+		},
+		{
+			Name:    "ns",
+			Usage:   "[NAMESPACE]",
+			Help:    "Show the current namespace, or switch to another one, requiring it if needed.",
+			MaxArgs: 1,
+			Run:     runNS,
+		},
+		{
+			Name:    "doc",
+			Usage:   "SYMBOL",
+			Help:    "Show the documentation for a var, special form or namespace.",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     runDoc,
+		},
+		{
+			Name:    "source",
+			Usage:   "SYMBOL",
+			Help:    "Show the source code for a var with line numbers.",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     runSource,
+		},
+		{
+			Name:    "edit",
+			Usage:   "SYMBOL",
+			Help:    "Open the definition of a var in $VISUAL or $EDITOR.",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     runEdit,
+		},
+		{
+			Name:    "apropos",
+			Usage:   "REGEX",
+			Help:    "Search for public vars whose names match the regex (e.g. ^re- or #\"^re-\") across namespaces.",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     runApropos,
+		},
+		{
+			Name: "namespaces",
+			Help: "List the loaded namespaces.",
+			Run: func(r *Repl, _ *CommandArgs) error {
+				return r.Namespaces()
+			},
+		},
+		{
+			Name:    "vars",
+			Usage:   "[NAMESPACE]",
+			Help:    "List the public vars of a namespace (defaults to the current one) with their arglists and docs.",
+			MaxArgs: 1,
+			Run:     runVars,
+		},
+		macroexpandCommand("macroexpand", "Expand the form, or the last form entered, repeatedly until it's no longer a macro form."),
+		macroexpandCommand("macroexpand-1", "Expand the form, or the last form entered, once."),
+		macroexpandCommand("macroexpand-all", "Expand all the macro forms in the form, or the last form entered."),
+		{
+			Name:    "time",
+			Usage:   "FORM",
+			Help:    "Evaluate a form and show the time it took.",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     runTime,
+		},
+		{
+			Name:    "history",
+			Usage:   "[N]",
+			Help:    fmt.Sprintf("Show the last N inputs evaluated in this session with their results (defaults to %d).", defaultHistorySize),
+			MaxArgs: 1,
+			Run:     runHistory,
+		},
+		{
+			Name:    "rerun",
+			Usage:   "N",
+			Help:    "Evaluate the history entry N again.",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     runRerun,
+		},
+		{
+			Name:    "diff",
+			Usage:   "N M",
+			Help:    "Show the differences between the results of the history entries N and M.",
+			MinArgs: 2,
+			MaxArgs: 2,
+			Run:     runDiff,
+		},
+		{
+			Name:    "save",
+			Usage:   "N FILE",
+			Help:    "Save the result of the history entry N to a local file.",
+			MinArgs: 2,
+			MaxArgs: 2,
+			Run:     runSave,
+		},
+		{
+			Name: "sessions",
+			Help: "List the sessions on the server.",
+			Run:  runSessions,
+		},
+		{
+			Name: "describe",
+			Help: "Show the versions and the ops supported by the server.",
+			Run:  runDescribe,
+		},
+		{
+			Name: "reload",
+			Help: "Reload the changed namespaces in dependency order.",
+			Run: func(r *Repl, _ *CommandArgs) error {
+				return r.Reload()
+			},
+		},
+		{
+			Name: "quit",
+			Help: "Quit the REPL.",
+			Run: func(*Repl, *CommandArgs) error {
+				return errQuit
+			},
+		},
+	}
+}
+
+func runHelp(r *Repl, args *CommandArgs) error {
+	out := r.reportWriter()
+	if len(args.Forms) == 1 {
+		name := strings.TrimPrefix(args.Forms[0], r.prefix())
+		cmd := r.lookupCommand(name)
+		if cmd == nil {
+			r.commandError("Unknown command: %s%s", r.prefix(), name)
+			return fmt.Errorf("unknown command: %s%s", r.prefix(), name)
+		}
+		fmt.Fprintln(out, r.commandUsage(cmd))
+		if cmd.Help != "" {
+			fmt.Fprintf(out, "  %s\n", cmd.Help)
+		}
+		return nil
+	}
+	cmds := r.allCommands()
+	width := 0
+	for _, cmd := range cmds {
+		if w := len(r.commandUsage(cmd)); w > width {
+			width = w
+		}
+	}
+	for _, cmd := range cmds {
+		r.printer.With(color.FgCyan).Fprintf(out, "  %-*s", width, r.commandUsage(cmd))
+		fmt.Fprintf(out, "  %s\n", cmd.Help)
+	}
+	return nil
+}
+
+func runNS(r *Repl, args *CommandArgs) error {
+	if len(args.Forms) == 0 {
+		fmt.Fprintln(r.reportWriter(), r.currentClient().CurrentNS())
+		return nil
+	}
+	return r.inNS(args.Forms[0])
+}
+
+// inNS switches to the namespace, requiring it first unless it's loaded,
+// so that in-ns doesn't create an empty namespace instead.
+func (r *Repl) inNS(ns string) error {
+	_, err := r.evalForCommand(fmt.Sprintf("(do (when-not (find-ns '%s) (require '%s)) (in-ns '%s))", ns, ns, ns))
+	return err
+}
+
+func runDoc(r *Repl, args *CommandArgs) error {
+	return r.Doc(args.Forms[0])
+}
+
+func runSource(r *Repl, args *CommandArgs) error {
+	return r.Source(args.Forms[0])
+}
+
+func runEdit(r *Repl, args *CommandArgs) error {
+	return r.Edit(args.Forms[0])
+}
+
+func runApropos(r *Repl, args *CommandArgs) error {
+	pattern, err := aproposPattern(args.Forms[0])
+	if err != nil {
+		r.commandError("Invalid pattern: %s", args.Forms[0])
+		return err
+	}
+	return r.Apropos(pattern)
+}
+
+func runVars(r *Repl, args *CommandArgs) error {
+	ns := r.currentClient().CurrentNS()
+	if len(args.Forms) == 1 {
+		ns = args.Forms[0]
+	}
+	return r.Vars(ns)
+}
+
+func runTime(r *Repl, args *CommandArgs) error {
+	return r.Eval(fmt.Sprintf("(time %s)", args.Forms[0]))
+}
+
+// op sends the op to the server and collects the responses to it.
+func (r *Repl) op(req map[string]interface{}) ([]map[string]interface{}, error) {
+	name := req["op"].(string)
+	if !r.SupportsOp(name) {
+		err := fmt.Errorf("%s op is not supported by the server", name)
+		r.commandError("The server does not support the %s op", name)
+		return nil, err
+	}
+	ch, ok := r.SendOp(req)
+	if !ok {
+		err := fmt.Errorf("%s op is not supported by the client", name)
+		r.commandError("The %s op is not available for this connection", name)
+		return nil, err
+	}
+	resps := []map[string]interface{}{}
+	for resp := range ch {
+		resps = append(resps, resp)
+	}
+	return resps, nil
+}
+
+// tryOp sends the op to the server and collects the responses to it if
+// the op is supported.
+func (r *Repl) tryOp(req map[string]interface{}) ([]map[string]interface{}, bool) {
+	if !r.SupportsOp(req["op"].(string)) {
+		return nil, false
+	}
+	ch, ok := r.SendOp(req)
+	if !ok {
+		return nil, false
+	}
+	resps := []map[string]interface{}{}
+	for resp := range ch {
+		resps = append(resps, resp)
+	}
+	return resps, true
+}
+
+func runSessions(r *Repl, _ *CommandArgs) error {
+	resps, err := r.op(map[string]interface{}{"op": "ls-sessions"})
+	if err != nil {
+		return err
+	}
+	current := ""
+	if holder, ok := r.currentClient().(client.SessionHolder); ok {
+		current = holder.Session()
+	}
+	out := r.reportWriter()
+	for _, resp := range resps {
+		sessions, _ := resp["sessions"].([]bencode.Datum)
+		ids := []string{}
+		for _, s := range sessions {
+			if id, ok := s.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if id == current {
+				r.printer.With(color.FgGreen).Fprintf(out, "* %s (current)\n", id)
+			} else {
+				fmt.Fprintf(out, "  %s\n", id)
+			}
+		}
+	}
+	return nil
+}
+
+func versionString(versions map[string]bencode.Datum, key string) string {
+	v, ok := versions[key].(map[string]bencode.Datum)
+	if !ok {
+		return ""
+	}
+	s, _ := v["version-string"].(string)
+	return s
+}
+
+func runDescribe(r *Repl, _ *CommandArgs) error {
+	resps, err := r.op(map[string]interface{}{"op": "describe"})
+	if err != nil {
+		return err
+	}
+	out := r.reportWriter()
+	for _, resp := range resps {
+		if versions, ok := resp["versions"].(map[string]bencode.Datum); ok {
+			names := map[string]string{"nrepl": "nREPL", "clojure": "Clojure", "java": "Java"}
+			parts := []string{}
+			for _, key := range []string{"nrepl", "clojure", "java"} {
+				if v := versionString(versions, key); v != "" {
+					parts = append(parts, names[key]+" "+v)
+				}
+			}
+			if len(parts) > 0 {
+				fmt.Fprintln(out, strings.Join(parts, ", "))
+			}
+		}
+		if ops, ok := resp["ops"].(map[string]bencode.Datum); ok {
+			names := make([]string, 0, len(ops))
+			for name := range ops {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			r.printer.With(color.FgCyan).Fprint(out, "Ops: ")
+			fmt.Fprintln(out, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package repl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+	"github.com/fatih/color"
+)
+
+// lookupCode is the fallback of the info and lookup ops. It returns the
+// information about the symbol resolved in the current namespace as an
+// EDN string, or nil if the symbol can't be resolved.
+const lookupCode = `(let [sym '%s` +
+	` spec (fn [k] (when-let [get-spec (resolve 'clojure.spec.alpha/get-spec)]` +
+	` (when-let [s (get-spec k)]` +
+	` (let [d ((resolve 'clojure.spec.alpha/describe) s)]` +
+	` (if (seq? d) (map pr-str d) [(pr-str d)])))))` +
+	` v (when-not (special-symbol? sym) (try (resolve sym) (catch Throwable _ nil)))` +
+	` info (cond` +
+	` (special-symbol? sym)` +
+	` (do (require 'clojure.repl)` +
+	` (let [m (#'clojure.repl/special-doc sym)]` +
+	` {:name (str (:name m))` +
+	` :arglists (some->> (:forms m) (map pr-str) (interpose "\n") (apply str))` +
+	` :doc (:doc m)` +
+	` :special true}))` +
+	` (var? v)` +
+	` (let [m (meta v)]` +
+	` {:ns (str (:ns m))` +
+	` :name (str (:name m))` +
+	` :arglists (some-> (:arglists m) pr-str)` +
+	` :doc (:doc m)` +
+	` :file (:file m)` +
+	` :line (:line m)` +
+	` :column (:column m)` +
+	` :macro (boolean (:macro m))` +
+	` :spec (spec (symbol (str (:ns m)) (str (:name m))))})` +
+	` :else` +
+	` (when-let [n (or (find-ns sym) ((ns-aliases *ns*) sym))]` +
+	` {:ns (str (ns-name n)) :doc (:doc (meta n)) :file (:file (meta n)) :namespace true}))]` +
+	` (binding [` + client.PrintBindings + `]` +
+	` (pr-str (some->> info (remove (comp nil? val)) (into {})))))`
+
+// symbolInfo is the information about a var, special form or namespace.
+type symbolInfo struct {
+	NS       string `edn:"ns"`
+	Name     string `edn:"name"`
+	Arglists string `edn:"arglists"`
+	Doc      string `edn:"doc"`
+	// File is the file path or URL as in the metadata of the var.
+	File string `edn:"file"`
+	// Resource is the path of the file relative to the classpath, if known.
+	Resource  string   `edn:"resource"`
+	Line      int      `edn:"line"`
+	Column    int      `edn:"column"`
+	Spec      []string `edn:"spec"`
+	Macro     bool     `edn:"macro"`
+	Special   bool     `edn:"special"`
+	Namespace bool     `edn:"namespace"`
+}
+
+// lookupSymbol looks up the symbol via the info op of cider-nrepl or the
+// lookup op of nREPL if available, and by evaluation otherwise. It returns
+// nil if the symbol can't be resolved.
+func (r *Repl) lookupSymbol(sym string) (*symbolInfo, error) {
+	ns := r.currentClient().CurrentNS()
+	for _, op := range []string{"info", "lookup"} {
+		resps, ok := r.tryOp(map[string]interface{}{"op": op, "sym": sym, "ns": ns})
+		if !ok {
+			continue
+		}
+		info := &symbolInfo{}
+		for _, resp := range resps {
+			if op == "lookup" {
+				m, _ := resp["info"].(map[string]bencode.Datum)
+				resp = map[string]interface{}{}
+				for k, v := range m {
+					resp[k] = v
+				}
+			}
+			info.merge(resp)
+		}
+		if info.Name == "" && info.NS == "" {
+			return nil, nil
+		}
+		info.Namespace = info.Name == ""
+		return info, nil
+	}
+	return r.lookupSymbolByEval(sym)
+}
+
+func (r *Repl) lookupSymbolByEval(sym string) (*symbolInfo, error) {
+	var info *symbolInfo
+	if err := r.evalEDN(fmt.Sprintf(lookupCode, sym), &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// merge fills in the fields from the response of the info or lookup op.
+func (info *symbolInfo) merge(m map[string]interface{}) {
+	str := func(key string) string {
+		s, _ := m[key].(string)
+		return s
+	}
+	flag := func(key string) bool {
+		switch v := m[key].(type) {
+		case string:
+			return v != "" && v != "false" && v != "nil"
+		case int:
+			return v != 0
+		default:
+			return false
+		}
+	}
+	if s := str("ns"); s != "" {
+		info.NS = s
+	}
+	if s := str("name"); s != "" {
+		info.Name = s
+	}
+	if s := str("arglists-str"); s != "" {
+		info.Arglists = s
+	}
+	if s := str("doc"); s != "" {
+		info.Doc = s
+	}
+	if s := str("file"); s != "" {
+		info.File = s
+	}
+	if s := str("resource"); s != "" {
+		info.Resource = s
+	}
+	if line, ok := m["line"].(int); ok {
+		info.Line = line
+	}
+	if column, ok := m["column"].(int); ok {
+		info.Column = column
+	}
+	if spec, ok := m["spec"].([]bencode.Datum); ok {
+		info.Spec = []string{}
+		for _, s := range spec {
+			if s, ok := s.(string); ok {
+				info.Spec = append(info.Spec, s)
+			}
+		}
+	}
+	info.Macro = info.Macro || flag("macro")
+	info.Special = info.Special || flag("special-form")
+}
+
+func (info *symbolInfo) qualifiedName() string {
+	switch {
+	case info.Name == "":
+		return info.NS
+	case info.NS == "" || info.Special:
+		return info.Name
+	default:
+		return info.NS + "/" + info.Name
+	}
+}
+
+// location returns the file and line where the var is defined, preferring
+// the path relative to the classpath to the full path or URL.
+func (info *symbolInfo) location() string {
+	file := info.Resource
+	if file == "" {
+		file = info.File
+	}
+	if file == "" || file == "NO_SOURCE_PATH" {
+		return ""
+	}
+	if info.Line > 0 {
+		return fmt.Sprintf("%s:%d", file, info.Line)
+	}
+	return file
+}
+
+// specLines formats the spec described as (fspec :args ... :ret ... :fn ...)
+// into the lines like "args: ...", as clojure.repl/doc does.
+func specLines(spec []string) []string {
+	if len(spec) == 0 {
+		return nil
+	}
+	if len(spec)%2 == 0 || !strings.HasSuffix(spec[0], "fspec") {
+		return []string{strings.Join(spec, " ")}
+	}
+	lines := []string{}
+	for i := 1; i+1 < len(spec); i += 2 {
+		if spec[i+1] == "nil" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", strings.TrimPrefix(spec[i], ":"), spec[i+1]))
+	}
+	return lines
+}
+
+func (r *Repl) printDoc(info *symbolInfo) {
+	out := r.reportWriter()
+	fmt.Fprintln(out, "-------------------------")
+	r.printer.With(color.FgCyan, color.Bold).Fprintln(out, info.qualifiedName())
+	if info.Arglists != "" {
+		r.printer.With(color.FgYellow).Fprintln(out, info.Arglists)
+	}
+	switch {
+	case info.Special:
+		r.printer.With(color.FgMagenta).Fprintln(out, "Special Form")
+	case info.Macro:
+		r.printer.With(color.FgMagenta).Fprintln(out, "Macro")
+	case info.Namespace:
+		r.printer.With(color.FgMagenta).Fprintln(out, "Namespace")
+	}
+	if info.Doc != "" {
+		fmt.Fprintf(out, "  %s\n", info.Doc)
+	}
+	if lines := specLines(info.Spec); len(lines) > 0 {
+		r.printer.With(color.FgMagenta).Fprintln(out, "Spec")
+		for _, line := range lines {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+	if loc := info.location(); loc != "" {
+		r.printer.With(color.Faint).Fprintln(out, loc)
+	}
+}
+
+// Doc shows the documentation for the var, special form or namespace named
+// by the symbol.
+func (r *Repl) Doc(sym string) error {
+	info, err := r.lookupSymbol(sym)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		r.commandError("No documentation found for %s", sym)
+		return fmt.Errorf("no documentation found for %s", sym)
+	}
+	r.printDoc(info)
+	return nil
+}
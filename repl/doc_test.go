@@ -0,0 +1,112 @@
+package repl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// opClient responds to the ops with the canned responses.
+type opClient struct {
+	*mockClient
+	resps map[string][]map[string]interface{}
+	reqs  []map[string]interface{}
+}
+
+func (c *opClient) SupportsOp(op string) bool {
+	_, ok := c.resps[op]
+	return ok
+}
+
+func (c *opClient) SendOp(req map[string]interface{}) <-chan map[string]interface{} {
+	c.reqs = append(c.reqs, req)
+	resps := c.resps[req["op"].(string)]
+	ch := make(chan map[string]interface{}, len(resps))
+	for _, resp := range resps {
+		ch <- resp
+	}
+	close(ch)
+	return ch
+}
+
+func setupOpRepl(resps map[string][]map[string]interface{}) (*Repl, *opClient) {
+	c := &opClient{mockClient: newMockClient(step{}), resps: resps}
+	repl := setupRepl(newMockReader(make(chan string)), c.mockClient)
+	repl.client = c
+	return repl, c
+}
+
+func TestDocWithInfoOp(t *testing.T) {
+	repl, c := setupOpRepl(map[string][]map[string]interface{}{
+		"info": {
+			{
+				"ns":           "clojure.core",
+				"name":         "map",
+				"arglists-str": "([f] [f coll])",
+				"doc":          "Returns a lazy sequence.",
+				"file":         "jar:file:/m2/clojure.jar!/clojure/core.clj",
+				"resource":     "clojure/core.clj",
+				"line":         2727,
+				"spec":         []bencode.Datum{"clojure.spec.alpha/fspec", ":args", "(cat :f ifn?)", ":ret", "seq?", ":fn", "nil"},
+			},
+			{"status": []bencode.Datum{"done"}},
+		},
+		"lookup": {},
+	})
+	assert.Nil(t, repl.Doc("map"))
+	assert.Equal(t, map[string]interface{}{"op": "info", "sym": "map", "ns": "user"}, c.reqs[0])
+	expected := "-------------------------\n" +
+		"clojure.core/map\n" +
+		"([f] [f coll])\n" +
+		"  Returns a lazy sequence.\n" +
+		"Spec\n" +
+		"  args: (cat :f ifn?)\n" +
+		"  ret: seq?\n" +
+		"clojure/core.clj:2727\n"
+	assert.Equal(t, expected, c.outs.String())
+}
+
+func TestDocWithLookupOp(t *testing.T) {
+	repl, c := setupOpRepl(map[string][]map[string]interface{}{
+		"lookup": {
+			{"info": map[string]bencode.Datum{
+				"ns":           "clojure.core",
+				"name":         "when",
+				"arglists-str": "([test & body])",
+				"macro":        "true",
+			}},
+		},
+	})
+	assert.Nil(t, repl.Doc("when"))
+	assert.Equal(t, "-------------------------\nclojure.core/when\n([test & body])\nMacro\n", c.outs.String())
+
+	c.resps["lookup"] = []map[string]interface{}{{"info": map[string]bencode.Datum{}}}
+	c.outs.Reset()
+	assert.NotNil(t, repl.Doc("nonexistent"))
+	assert.Equal(t, "No documentation found for nonexistent\n", c.outs.String())
+}
+
+func TestDocByEval(t *testing.T) {
+	c := newMockClient(step{fmt.Sprintf(lookupCode, "if"), func(ch chan<- client.EvalResult) {
+		ch <- `"{:name \"if\", :arglists \"(if test then else?)\", :doc \"Evaluates test.\", :special true}"`
+	}})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	assert.Nil(t, repl.Doc("if"))
+	assert.Equal(t, "-------------------------\nif\n(if test then else?)\nSpecial Form\n  Evaluates test.\n", c.outs.String())
+
+	c.step = step{fmt.Sprintf(lookupCode, "clojure.string"), func(ch chan<- client.EvalResult) {
+		ch <- `"{:ns \"clojure.string\", :doc \"String functions.\", :namespace true}"`
+	}}
+	c.outs.Reset()
+	assert.Nil(t, repl.Doc("clojure.string"))
+	assert.Equal(t, "-------------------------\nclojure.string\nNamespace\n  String functions.\n", c.outs.String())
+}
+
+func TestSpecLines(t *testing.T) {
+	assert.Nil(t, specLines(nil))
+	assert.Equal(t, []string{"args: (cat :x int?)"}, specLines([]string{"fspec", ":args", "(cat :x int?)", ":ret", "nil"}))
+	assert.Equal(t, []string{"int?"}, specLines([]string{"int?"}))
+}
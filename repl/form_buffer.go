@@ -0,0 +1,53 @@
+package repl
+
+import (
+	"fmt"
+
+	"github.com/athos/trenchman/reader"
+)
+
+// formBuffer splits the input fed line by line into top-level forms.
+type formBuffer struct {
+	buf []rune
+}
+
+// feed appends the line to the buffer and returns the forms completed so far.
+// Whitespaces and comments between forms are dropped.
+func (b *formBuffer) feed(line string) ([]string, error) {
+	b.buf = append(b.buf, []rune(line)...)
+	return b.scan(false)
+}
+
+// flush returns the rest of the forms in the buffer at the end of input.
+func (b *formBuffer) flush() ([]string, error) {
+	return b.scan(true)
+}
+
+func (b *formBuffer) scan(eof bool) ([]string, error) {
+	forms := []string{}
+	for {
+		r := reader.NewReader(b.buf, eof)
+		r.SkipSpaces()
+		if r.AtEnd() {
+			b.buf = nil
+			return forms, nil
+		}
+		start := r.Pos()
+		_, err := r.Read()
+		if err == reader.ErrIncomplete {
+			if eof {
+				rest := string(b.buf[start:])
+				b.buf = nil
+				return forms, fmt.Errorf("EOF while reading: %s", rest)
+			}
+			b.buf = b.buf[start:]
+			return forms, nil
+		}
+		if err != nil {
+			b.buf = nil
+			return forms, err
+		}
+		forms = append(forms, string(b.buf[start:r.Pos()]))
+		b.buf = b.buf[r.Pos():]
+	}
+}
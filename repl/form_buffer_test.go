@@ -0,0 +1,94 @@
+package repl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormBuffer(t *testing.T) {
+	tests := []struct {
+		input    []string
+		expected []string
+	}{
+		{
+			[]string{"(+ 1 2)\n"},
+			[]string{"(+ 1 2)"},
+		},
+		{
+			[]string{"(def x 1) x\n", "42 :foo/bar \"baz\"\n"},
+			[]string{"(def x 1)", "x", "42", ":foo/bar", "\"baz\""},
+		},
+		{
+			[]string{"(defn f [x]\n", "  ;; ignore )\n", "  (inc x))\n"},
+			[]string{"(defn f [x]\n  ;; ignore )\n  (inc x))"},
+		},
+		{
+			[]string{"; comment (\n", "(f \"a)\" \\) \\space)\n"},
+			[]string{"(f \"a)\" \\) \\space)"},
+		},
+		{
+			[]string{"'(1 2) @a `(~x ~@xs)\n"},
+			[]string{"'(1 2)", "@a", "`(~x ~@xs)"},
+		},
+		{
+			[]string{"^:private ^{:a 1}\n", "(def x)\n"},
+			[]string{"^:private ^{:a 1}\n(def x)"},
+		},
+		{
+			[]string{"#{1 2} #(inc %) #\"\\d+\" #'f #_(ignored) x\n"},
+			[]string{"#{1 2}", "#(inc %)", "#\"\\d+\"", "#'f", "#_(ignored) x"},
+		},
+		{
+			[]string{"#?(:clj 1) #:a{:b 1} #inst \"2022-01-01\" ##Inf\n"},
+			[]string{"#?(:clj 1)", "#:a{:b 1}", "#inst \"2022-01-01\"", "##Inf"},
+		},
+		{
+			[]string{"#!/usr/bin/env trench\n", "(println 1)\n"},
+			[]string{"(println 1)"},
+		},
+		{
+			[]string{"x"},
+			[]string{"x"},
+		},
+	}
+	for _, tt := range tests {
+		b := &formBuffer{}
+		forms := []string{}
+		for _, line := range tt.input {
+			fs, err := b.feed(line)
+			assert.Nil(t, err)
+			forms = append(forms, fs...)
+		}
+		fs, err := b.flush()
+		assert.Nil(t, err)
+		forms = append(forms, fs...)
+		assert.Equal(t, tt.expected, forms)
+	}
+}
+
+func TestFormBufferIncremental(t *testing.T) {
+	b := &formBuffer{}
+	forms, err := b.feed("(+ 1\n")
+	assert.Nil(t, err)
+	assert.Empty(t, forms)
+	forms, err = b.feed("   2) (inc\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"(+ 1\n   2)"}, forms)
+	forms, err = b.feed("3)\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"(inc\n3)"}, forms)
+}
+
+func TestFormBufferErrors(t *testing.T) {
+	b := &formBuffer{}
+	forms, err := b.feed("(f) (g))\n")
+	assert.Equal(t, []string{"(f)", "(g)"}, forms)
+	assert.NotNil(t, err)
+
+	b = &formBuffer{}
+	_, err = b.feed("(f\n")
+	assert.Nil(t, err)
+	_, err = b.flush()
+	assert.NotNil(t, err)
+}
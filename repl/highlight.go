@@ -0,0 +1,141 @@
+package repl
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+type segment struct {
+	text  string
+	attrs []color.Attribute
+}
+
+var highlightedForms = map[string]bool{
+	"def": true, "defn": true, "defn-": true, "defmacro": true, "defmulti": true,
+	"defmethod": true, "defprotocol": true, "defrecord": true, "deftype": true,
+	"defonce": true, "ns": true, "fn": true, "fn*": true, "let": true,
+	"letfn": true, "loop": true, "recur": true, "if": true, "if-let": true,
+	"if-not": true, "when": true, "when-let": true, "when-not": true,
+	"cond": true, "condp": true, "case": true, "do": true, "try": true,
+	"catch": true, "finally": true, "throw": true, "quote": true, "var": true,
+	"binding": true, "doseq": true, "dotimes": true, "for": true, "new": true,
+	"set!": true,
+}
+
+func isDelimiter(c rune) bool {
+	return unicode.IsSpace(c) || strings.ContainsRune(`()[]{}",;`, c)
+}
+
+func tokenEnd(cs []rune, i int) int {
+	for i < len(cs) && !isDelimiter(cs[i]) {
+		i++
+	}
+	return i
+}
+
+// stringEnd returns the position right after the closing quote of the
+// string starting at i, or -1 if the string doesn't end in cs.
+func stringEnd(cs []rune, i int) int {
+	for ; i < len(cs); i++ {
+		switch cs[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func isNumber(token string) bool {
+	token = strings.TrimLeft(token, "+-")
+	return token != "" && '0' <= token[0] && token[0] <= '9'
+}
+
+// highlightLine splits the line of Clojure code into the segments to be
+// printed with colors. inString tells whether the line starts in the middle
+// of a string, and the returned bool whether the line ends in a string.
+func highlightLine(line string, inString bool) ([]segment, bool) {
+	cs := []rune(line)
+	segs := []segment{}
+	i := 0
+	emit := func(end int, attrs ...color.Attribute) {
+		segs = append(segs, segment{string(cs[i:end]), attrs})
+		i = end
+	}
+	if inString {
+		end := stringEnd(cs, 0)
+		if end < 0 {
+			emit(len(cs), color.FgGreen)
+			return segs, true
+		}
+		emit(end, color.FgGreen)
+	}
+	head := false
+	for i < len(cs) {
+		c := cs[i]
+		switch {
+		case c == ';':
+			emit(len(cs), color.Faint)
+		case c == '"':
+			end := stringEnd(cs, i+1)
+			if end < 0 {
+				emit(len(cs), color.FgGreen)
+				return segs, true
+			}
+			emit(end, color.FgGreen)
+		case c == '\\':
+			end := i + 2
+			if end > len(cs) {
+				end = len(cs)
+			}
+			emit(tokenEnd(cs, end), color.FgGreen)
+		case c == ':':
+			emit(tokenEnd(cs, i+1), color.FgCyan)
+		case isDelimiter(c) || strings.ContainsRune("'`~@^#", c):
+			emit(i + 1)
+			head = c == '('
+			continue
+		default:
+			end := tokenEnd(cs, i)
+			token := string(cs[i:end])
+			switch {
+			case isNumber(token), token == "nil", token == "true", token == "false":
+				emit(end, color.FgBlue)
+			case head && highlightedForms[token]:
+				emit(end, color.FgMagenta)
+			default:
+				emit(end)
+			}
+		}
+		head = false
+	}
+	return segs, false
+}
+
+// printHighlighted prints the Clojure code with colors, prefixing each line
+// with its line number if firstLine > 0.
+func (r *Repl) printHighlighted(w io.Writer, code string, firstLine int) {
+	lines := strings.Split(strings.TrimRight(code, "\n"), "\n")
+	width := len(strconv.Itoa(firstLine + len(lines) - 1))
+	inString := false
+	for i, line := range lines {
+		if firstLine > 0 {
+			r.printer.With(color.Faint).Fprintf(w, "%*d  ", width, firstLine+i)
+		}
+		var segs []segment
+		segs, inString = highlightLine(line, inString)
+		for _, seg := range segs {
+			if len(seg.attrs) == 0 {
+				io.WriteString(w, seg.text)
+			} else {
+				r.printer.With(seg.attrs...).Fprint(w, seg.text)
+			}
+		}
+		io.WriteString(w, "\n")
+	}
+}
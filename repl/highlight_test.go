@@ -0,0 +1,38 @@
+package repl
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlightLine(t *testing.T) {
+	segs, inString := highlightLine(`(defn f [x] (inc x 1.5 :k nil \a)) ; done`, false)
+	assert.False(t, inString)
+	colored := map[string]color.Attribute{}
+	text := ""
+	for _, seg := range segs {
+		text += seg.text
+		if len(seg.attrs) > 0 {
+			colored[seg.text] = seg.attrs[0]
+		}
+	}
+	assert.Equal(t, `(defn f [x] (inc x 1.5 :k nil \a)) ; done`, text)
+	assert.Equal(t, map[string]color.Attribute{
+		"defn":   color.FgMagenta,
+		"1.5":    color.FgBlue,
+		":k":     color.FgCyan,
+		"nil":    color.FgBlue,
+		`\a`:     color.FgGreen,
+		"; done": color.Faint,
+	}, colored)
+
+	segs, inString = highlightLine(`  "A docstring`, false)
+	assert.True(t, inString)
+	assert.Equal(t, segment{`"A docstring`, []color.Attribute{color.FgGreen}}, segs[len(segs)-1])
+
+	segs, inString = highlightLine(`  spanning \"lines." [x]`, true)
+	assert.False(t, inString)
+	assert.Equal(t, segment{`  spanning \"lines."`, []color.Attribute{color.FgGreen}}, segs[0])
+}
@@ -0,0 +1,270 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/athos/trenchman/client"
+	"github.com/fatih/color"
+)
+
+// defaultHistorySize is the number of entries shown by ,history by default.
+const defaultHistorySize = 20
+
+// maxResultWidth is the width beyond which results are abbreviated in the
+// list of history entries.
+const maxResultWidth = 72
+
+// historyEntry is an input evaluated in this session along with the last
+// value printed for it, or the error that occurred.
+type historyEntry struct {
+	Code  string
+	Value string
+	Err   string
+}
+
+func (e *historyEntry) result() string {
+	if e.Err != "" {
+		return "!! " + e.Err
+	}
+	return e.Value
+}
+
+// evalAndRecord evaluates the code entered, and records it along with the
+// result in the history.
+func (r *Repl) evalAndRecord(code string) error {
+	entry := &historyEntry{Code: code}
+	r.history = append(r.history, entry)
+	r.recordInput(code)
+	value, err := r.handleResults(r.currentClient().Eval(code), false)
+	r.recordError(err)
+	if err != nil {
+		entry.Err = strings.TrimSpace(err.Error())
+	} else {
+		entry.Value = value
+	}
+	return err
+}
+
+// historyEntry returns the entry numbered by the argument, reporting the
+// error if it's invalid.
+func (r *Repl) historyEntry(arg string) (*historyEntry, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n <= 0 || n > len(r.history) {
+		r.commandError("No such history entry: %s", arg)
+		return nil, fmt.Errorf("no such history entry: %s", arg)
+	}
+	return r.history[n-1], nil
+}
+
+// abbreviate cuts the string at the first newline, and to the width in
+// runes, so that multibyte characters are never split.
+func abbreviate(s string, width int) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + " ..."
+	}
+	if rs := []rune(s); len(rs) > width {
+		s = string(rs[:width-4]) + " ..."
+	}
+	return s
+}
+
+func runHistory(r *Repl, args *CommandArgs) error {
+	n := defaultHistorySize
+	if len(args.Forms) == 1 {
+		i, err := strconv.Atoi(args.Forms[0])
+		if err != nil || i <= 0 {
+			r.commandError("N must be a positive integer: %s", args.Forms[0])
+			return fmt.Errorf("invalid history size: %s", args.Forms[0])
+		}
+		n = i
+	}
+	start := len(r.history) - n
+	if start < 0 {
+		start = 0
+	}
+	out := r.reportWriter()
+	for i := start; i < len(r.history); i++ {
+		entry := r.history[i]
+		r.printer.With(color.FgCyan).Fprintf(out, "%4d  ", i+1)
+		fmt.Fprintln(out, strings.ReplaceAll(entry.Code, "\n", "\n      "))
+		if entry.Err != "" {
+			r.printer.With(color.FgRed).Fprintf(out, "      %s\n", abbreviate(entry.result(), maxResultWidth))
+		} else if entry.Value != "" {
+			fmt.Fprintf(out, "      => %s\n", abbreviate(entry.Value, maxResultWidth))
+		}
+	}
+	return nil
+}
+
+func runRerun(r *Repl, args *CommandArgs) error {
+	entry, err := r.historyEntry(args.Forms[0])
+	if err != nil {
+		return err
+	}
+	if r.events == nil {
+		r.printer.With(color.Faint).Fprintln(r.out, entry.Code)
+	}
+	return r.evalAndRecord(entry.Code)
+}
+
+// maxDiffCells is the maximum size of the table to compute the line diff
+// with. Larger results are shown as replaced as a whole, except for the
+// lines in common at the beginning and the end.
+const maxDiffCells = 1 << 20
+
+// prettyValuesCode pretty-prints the two values read back on the server,
+// and compares them as values, so that the differences in the layout (or
+// e.g. in the order of map entries) don't count. Values that can't be read
+// back are left as printed.
+const prettyValuesCode = `(do (require 'clojure.pprint 'clojure.edn)` +
+	` (let [read (fn [s] (try [(clojure.edn/read-string {:default tagged-literal} s)] (catch Exception _ nil)))` +
+	` a (read %s)` +
+	` b (read %s)` +
+	` pp (fn [v] (when v (with-out-str (clojure.pprint/pprint (first v)))))]` +
+	` (binding [` + client.PrintBindings + `]` +
+	` (pr-str {:equal (boolean (and a b (= a b))) :a (pp a) :b (pp b)}))))`
+
+type prettyValues struct {
+	Equal bool   `edn:"equal"`
+	A     string `edn:"a"`
+	B     string `edn:"b"`
+}
+
+// lineDiff returns the lines of the diff between a and b, each prefixed
+// with "- ", "+ " or "  ".
+func lineDiff(a, b []string) []string {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ret := []string{}
+	for _, line := range a[:prefix] {
+		ret = append(ret, "  "+line)
+	}
+	ret = append(ret, middleDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ret = append(ret, "  "+line)
+	}
+	return ret
+}
+
+// middleDiff computes the diff of the lines via their longest common
+// subsequence, unless the table for it would be too large.
+func middleDiff(a, b []string) []string {
+	ret := []string{}
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			ret = append(ret, "- "+line)
+		}
+		for _, line := range b {
+			ret = append(ret, "+ "+line)
+		}
+		return ret
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ret = append(ret, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ret = append(ret, "- "+a[i])
+			i++
+		default:
+			ret = append(ret, "+ "+b[j])
+			j++
+		}
+	}
+	return ret
+}
+
+func runDiff(r *Repl, args *CommandArgs) error {
+	e1, err := r.historyEntry(args.Forms[0])
+	if err != nil {
+		return err
+	}
+	e2, err := r.historyEntry(args.Forms[1])
+	if err != nil {
+		return err
+	}
+	out := r.reportWriter()
+	result1, result2 := e1.result(), e2.result()
+	if result1 == result2 {
+		fmt.Fprintln(out, "No differences")
+		return nil
+	}
+	if e1.Err == "" && e2.Err == "" {
+		var pretty prettyValues
+		code := fmt.Sprintf(prettyValuesCode, client.QuoteString(e1.Value), client.QuoteString(e2.Value))
+		if err := r.evalEDN(code, &pretty); err != nil {
+			return err
+		}
+		if pretty.Equal {
+			fmt.Fprintln(out, "No differences")
+			return nil
+		}
+		if pretty.A != "" {
+			result1 = strings.TrimSuffix(pretty.A, "\n")
+		}
+		if pretty.B != "" {
+			result2 = strings.TrimSuffix(pretty.B, "\n")
+		}
+	}
+	r.printer.With(color.FgRed).Fprintf(out, "--- %s: %s\n", args.Forms[0], abbreviate(e1.Code, maxResultWidth))
+	r.printer.With(color.FgGreen).Fprintf(out, "+++ %s: %s\n", args.Forms[1], abbreviate(e2.Code, maxResultWidth))
+	for _, line := range lineDiff(strings.Split(result1, "\n"), strings.Split(result2, "\n")) {
+		switch line[0] {
+		case '-':
+			r.printer.With(color.FgRed).Fprintln(out, line)
+		case '+':
+			r.printer.With(color.FgGreen).Fprintln(out, line)
+		default:
+			fmt.Fprintln(out, line)
+		}
+	}
+	return nil
+}
+
+func runSave(r *Repl, args *CommandArgs) error {
+	entry, err := r.historyEntry(args.Forms[0])
+	if err != nil {
+		return err
+	}
+	if entry.Err != "" {
+		r.commandError("Entry %s has no result: %s", args.Forms[0], entry.Err)
+		return errors.New("no result to save")
+	}
+	path := unquote(args.Forms[1])
+	if err := os.WriteFile(path, []byte(entry.Value+"\n"), 0644); err != nil {
+		r.commandError("Failed to save the result (%s)", err)
+		return err
+	}
+	fmt.Fprintf(r.reportWriter(), "Saved the result of entry %s to %s\n", args.Forms[0], path)
+	return nil
+}
@@ -0,0 +1,120 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/athos/trenchman/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		expected []string
+	}{
+		{[]string{"a"}, []string{"a"}, []string{"  a"}},
+		{[]string{"a"}, []string{"b"}, []string{"- a", "+ b"}},
+		{[]string{"a", "b", "c"}, []string{"a", "x", "c", "d"}, []string{"  a", "- b", "+ x", "  c", "+ d"}},
+		{[]string{}, []string{"a"}, []string{"+ a"}},
+		{[]string{"a", "b", "c"}, []string{"a", "c"}, []string{"  a", "- b", "  c"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, lineDiff(tt.a, tt.b))
+	}
+}
+
+func TestLineDiffTooLarge(t *testing.T) {
+	a := make([]string, 2000)
+	b := make([]string, 2000)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d", i)
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+	a = append([]string{"head"}, append(a, "tail")...)
+	b = append([]string{"head"}, append(b, "tail")...)
+	diff := lineDiff(a, b)
+	assert.Equal(t, 4002, len(diff))
+	assert.Equal(t, "  head", diff[0])
+	assert.Equal(t, "- a0", diff[1])
+	assert.Equal(t, "+ b0", diff[2001])
+	assert.Equal(t, "  tail", diff[4001])
+}
+
+func TestAbbreviate(t *testing.T) {
+	assert.Equal(t, "short", abbreviate("short", 10))
+	assert.Equal(t, "{:a 1 ...", abbreviate("{:a 1\n :b 2}", 20))
+	assert.Equal(t, "012345 ...", abbreviate("0123456789abc", 10))
+	assert.Equal(t, "\"日本語\"", abbreviate("\"日本語\"", 5))
+	assert.Equal(t, "\"あいう ...", abbreviate("\"あいうえおかきくけこ\"", 8))
+	assert.Equal(t, "λ→ ...", abbreviate("λ→λ→λ→λ→", 6))
+}
+
+func TestRerun(t *testing.T) {
+	c := newMockClient(step{"(/ 1 0)", func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeError("Divide by zero\n")
+	}})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	assert.NotNil(t, repl.evalAndRecord("(/ 1 0)"))
+
+	c.step = step{"(/ 1 0)", func(ch chan<- client.EvalResult) {
+		ch <- "1/2"
+	}}
+	assert.Nil(t, repl.RunCommand("rerun", "1"))
+	assert.Equal(t, "(/ 1 0)\n1/2\n", c.outs.String())
+	assert.Equal(t, []*historyEntry{
+		{Code: "(/ 1 0)", Err: "Divide by zero"},
+		{Code: "(/ 1 0)", Value: "1/2"},
+	}, repl.history)
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("rerun", "3"))
+	assert.Equal(t, "No such history entry: 3\n", c.outs.String())
+}
+
+func TestDiffAndSave(t *testing.T) {
+	c := newMockClient(step{})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	repl.history = []*historyEntry{
+		{Code: "(f)", Value: "{:a 1, :b 2}"},
+		{Code: "(f)", Value: "{:a 1, :b 3}"},
+		{Code: "(g)", Value: "{:b 2, :a 1}"},
+		{Code: "(h)", Err: "Boom"},
+		{Code: "(f)", Value: "{:a 1, :b 2}"},
+	}
+	prettyValuesStep := func(a, b, value string) step {
+		return step{fmt.Sprintf(prettyValuesCode, client.QuoteString(a), client.QuoteString(b)), func(ch chan<- client.EvalResult) {
+			ch <- value
+		}}
+	}
+	c.step = prettyValuesStep("{:a 1, :b 2}", "{:a 1, :b 3}", `"{:equal false, :a \"{:a 1,\\n :b 2}\\n\", :b \"{:a 1,\\n :b 3}\\n\"}"`)
+	assert.Nil(t, repl.RunCommand("diff", "1 2"))
+	assert.Equal(t, "--- 1: (f)\n+++ 2: (f)\n  {:a 1,\n-  :b 2}\n+  :b 3}\n", c.outs.String())
+
+	c.outs.Reset()
+	c.step = prettyValuesStep("{:a 1, :b 2}", "{:b 2, :a 1}", `"{:equal true, :a \"{:a 1, :b 2}\\n\", :b \"{:b 2, :a 1}\\n\"}"`)
+	assert.Nil(t, repl.RunCommand("diff", "1 3"))
+	assert.Equal(t, "No differences\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.Nil(t, repl.RunCommand("diff", "1 5"))
+	assert.Equal(t, "No differences\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.Nil(t, repl.RunCommand("diff", "1 4"))
+	assert.Equal(t, "--- 1: (f)\n+++ 4: (h)\n- {:a 1, :b 2}\n+ !! Boom\n", c.outs.String())
+
+	path := filepath.Join(t.TempDir(), "result.edn")
+	c.outs.Reset()
+	assert.Nil(t, repl.RunCommand("save", "2 \""+path+"\""))
+	assert.Equal(t, "Saved the result of entry 2 to "+path+"\n", c.outs.String())
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "{:a 1, :b 3}\n", string(content))
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("save", "4 "+path))
+	assert.Equal(t, "Entry 4 has no result: Boom\n", c.outs.String())
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"io"
+	"sync"
 )
 
 type (
@@ -12,7 +13,15 @@ type (
 		cancelCh chan struct{}
 		notifyCh chan struct{}
 		resultCh chan interface{}
-		returnCh chan interface{}
+		lock     sync.Mutex
+		// request is the last read request, which is shared by the calls
+		// to readLine until its result is received
+		request *readRequest
+	}
+
+	readRequest struct {
+		ch   chan interface{}
+		done chan struct{}
 	}
 )
 
@@ -24,11 +33,11 @@ func newReader(r io.Reader) *interruptibleReader {
 		cancelCh: make(chan struct{}),
 		notifyCh: make(chan struct{}),
 		resultCh: make(chan interface{}),
-		returnCh: make(chan interface{}),
 	}
 	go func() {
 		for range reader.notifyCh {
-			if res, err := reader.reader.ReadString('\n'); err != nil {
+			// the last line without a newline is returned before the error
+			if res, err := reader.reader.ReadString('\n'); err != nil && res == "" {
 				reader.resultCh <- err
 			} else {
 				reader.resultCh <- res
@@ -38,29 +47,57 @@ func newReader(r io.Reader) *interruptibleReader {
 	return reader
 }
 
+// readLine returns the channel that receives the next line or error. A new
+// read is started only if the result of the previous one has been received,
+// so that calling readLine repeatedly, e.g. while waiting for evaluation
+// results, never leaves extra reads pending on the input.
 func (r *interruptibleReader) readLine() <-chan interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if req := r.request; req != nil && (!req.isDone() || len(req.ch) > 0) {
+		return req.ch
+	}
+	req := &readRequest{ch: make(chan interface{}, 1), done: make(chan struct{})}
+	r.request = req
 	go func() {
 		//FIXME: added to ignore occasional panic that says "send on closed channel"
 		defer func() {
 			recover()
 		}()
+		var res interface{}
 		select {
-		case _, ok := <-r.cancelCh:
-			if ok {
-				r.returnCh <- errInterrupted
-			}
-		case res := <-r.resultCh:
-			r.returnCh <- res
+		case <-r.cancelCh:
+			res = errInterrupted
+		case res = <-r.resultCh:
 		case r.notifyCh <- struct{}{}:
 			select {
 			case <-r.cancelCh:
-				r.returnCh <- errInterrupted
-			case res := <-r.resultCh:
-				r.returnCh <- res
+				res = errInterrupted
+			case res = <-r.resultCh:
 			}
 		}
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		req.ch <- res
+		close(req.done)
 	}()
-	return r.returnCh
+	return req.ch
+}
+
+func (req *readRequest) isDone() bool {
+	select {
+	case <-req.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// pending reports whether a read request is waiting for its result.
+func (r *interruptibleReader) pending() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.request != nil && !r.request.isDone()
 }
 
 func (r *interruptibleReader) Close() error {
@@ -68,6 +105,18 @@ func (r *interruptibleReader) Close() error {
 	return nil
 }
 
+// interrupt interrupts the read request waiting for its result, if any.
+// Nothing happens if there is no such request, so that the interruption
+// isn't left to cancel a later read.
 func (r *interruptibleReader) interrupt() {
-	r.cancelCh <- struct{}{}
+	r.lock.Lock()
+	req := r.request
+	r.lock.Unlock()
+	if req == nil {
+		return
+	}
+	select {
+	case r.cancelCh <- struct{}{}:
+	case <-req.done:
+	}
 }
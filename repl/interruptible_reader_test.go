@@ -3,7 +3,9 @@ package repl
 import (
 	"bytes"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -39,6 +41,26 @@ func TestReadLine(t *testing.T) {
 	assert.Nil(t, r.Close())
 }
 
+func TestReadLineSharesPendingRead(t *testing.T) {
+	in := make(chan string)
+	reader := &countingReader{mockReader: newMockReader(in)}
+	r := newReader(reader)
+	ch := r.readLine()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, ch, r.readLine())
+	}
+	in <- "hello\n"
+	assert.Equal(t, "hello\n", <-ch)
+	// no read is left pending after the result is received
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reader.reading))
+	assert.False(t, r.pending())
+	ch = r.readLine()
+	in <- "world\n"
+	assert.Equal(t, "world\n", <-ch)
+	assert.Nil(t, r.Close())
+}
+
 func TestInterrupt(t *testing.T) {
 	t.Run("interrupt interrupts readLine", func(t *testing.T) {
 		b := newThreadSafeBuffer()
@@ -52,6 +74,15 @@ func TestInterrupt(t *testing.T) {
 		assert.True(t, ok)
 		assert.Nil(t, r.Close())
 	})
+	t.Run("interrupt without pending reads does nothing", func(t *testing.T) {
+		b := newThreadSafeBuffer()
+		r := newReader(b)
+		r.interrupt()
+		ch := r.readLine()
+		b.WriteString("hello\n")
+		assert.Equal(t, "hello\n", <-ch)
+		assert.Nil(t, r.Close())
+	})
 	// t.Run("readLine after interruption successfully reads line", func(t *testing.T) {
 	// 	b := newThreadSafeBuffer()
 	// 	r := newReader(b)
@@ -0,0 +1,79 @@
+package repl
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/athos/trenchman/client"
+)
+
+type (
+	// Event is emitted for each output and result in JSON output mode, and
+	// for each input as well in transcripts.
+	Event struct {
+		Type     string     `json:"type"`
+		Time     *time.Time `json:"time,omitempty"`
+		Text     string     `json:"text,omitempty"`
+		NS       string     `json:"ns,omitempty"`
+		Value    *string    `json:"value,omitempty"`
+		Message  string     `json:"message,omitempty"`
+		Class    string     `json:"class,omitempty"`
+		Phase    string     `json:"phase,omitempty"`
+		Location *Location  `json:"location,omitempty"`
+	}
+
+	Location struct {
+		Source string `json:"source,omitempty"`
+		Line   int    `json:"line,omitempty"`
+		Column int    `json:"column,omitempty"`
+	}
+
+	eventWriter struct {
+		lock    sync.Mutex
+		encoder *json.Encoder
+	}
+)
+
+const (
+	EventOut       = "out"
+	EventErr       = "err"
+	EventValue     = "value"
+	EventException = "exception"
+	EventInput     = "input"
+)
+
+func newEventWriter(w io.Writer) *eventWriter {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &eventWriter{encoder: encoder}
+}
+
+// write emits the event as a line of JSON. Events may come from multiple
+// goroutines (e.g. output from the server during evaluation).
+func (w *eventWriter) write(event *Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.encoder.Encode(event)
+}
+
+func valueEvent(ns, value string) *Event {
+	return &Event{Type: EventValue, NS: ns, Value: &value}
+}
+
+func exceptionEvent(err *client.RuntimeError) *Event {
+	event := &Event{Type: EventException, Message: err.Error()}
+	if details := err.Details(); details != nil {
+		event.Class = details.Class
+		event.Phase = details.Phase
+		if details.Source != "" || details.Line != 0 {
+			event.Location = &Location{
+				Source: details.Source,
+				Line:   details.Line,
+				Column: details.Column,
+			}
+		}
+	}
+	return event
+}
@@ -0,0 +1,115 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/athos/trenchman/client"
+)
+
+// tidyCode replaces the qualified symbols in form with the unqualified
+// ones if they resolve to the same vars in the current namespace, or with
+// the ones qualified by the aliases otherwise, as cider-nrepl's "tidy"
+// display does.
+const tidyCode = `(clojure.walk/postwalk` +
+	` (fn [x]` +
+	` (if (and (symbol? x) (namespace x))` +
+	` (let [v (try (resolve x) (catch Exception _ nil))]` +
+	` (if (and (var? v) (= v (try (ns-resolve *ns* (symbol (name x))) (catch Exception _ nil))))` +
+	` (symbol (name x))` +
+	` (or (some (fn [[a n]] (when (= (str (ns-name n)) (namespace x)) (symbol (str a) (name x))))` +
+	` (ns-aliases *ns*))` +
+	` x)))` +
+	` x))` +
+	` form)`
+
+const macroexpandCode = `(do (require 'clojure.pprint 'clojure.walk)` +
+	` (let [form (%s '%s)` +
+	` form (if %t ` + tidyCode + ` form)]` +
+	` (binding [` + client.PrintBindings + `]` +
+	` (with-out-str (clojure.pprint/pprint form)))))`
+
+var expanders = map[string]string{
+	"macroexpand":     "clojure.core/macroexpand",
+	"macroexpand-1":   "clojure.core/macroexpand-1",
+	"macroexpand-all": "clojure.walk/macroexpand-all",
+}
+
+// Macroexpand expands the form in the current namespace with the expander,
+// which is one of macroexpand, macroexpand-1 and macroexpand-all, and
+// pretty-prints the expansion. If tidy is true, namespaces of the symbols
+// are omitted or abbreviated to the aliases where possible.
+func (r *Repl) Macroexpand(expander, form string, tidy bool) error {
+	var expansion string
+	display := "qualified"
+	if tidy {
+		display = "tidy"
+	}
+	req := map[string]interface{}{
+		"op":                 "macroexpand",
+		"expander":           expander,
+		"code":               form,
+		"ns":                 r.currentClient().CurrentNS(),
+		"display-namespaces": display,
+	}
+	if resps, ok := r.tryOp(req); ok {
+		for _, resp := range resps {
+			if client.HasStatus(resp, "macroexpand-error") {
+				if ex, ok := resp["ex"].(string); ok {
+					r.commandError("Failed to expand %s (%s)", form, ex)
+				} else {
+					r.commandError("Failed to expand %s", form)
+				}
+				return errors.New("macroexpansion failed")
+			}
+			if s, ok := resp["expansion"].(string); ok {
+				expansion = s
+			}
+		}
+	} else {
+		s, err := r.evalString(fmt.Sprintf(macroexpandCode, expanders[expander], form, tidy))
+		if err != nil {
+			return err
+		}
+		expansion = s
+	}
+	r.printHighlighted(r.reportWriter(), expansion, 0)
+	return nil
+}
+
+func macroexpandCommand(expander, help string) *Command {
+	cmd := &Command{
+		Name:    expander,
+		Usage:   "[:tidy] [FORM]",
+		Help:    help,
+		MaxArgs: 2,
+	}
+	cmd.Run = func(r *Repl, args *CommandArgs) error {
+		forms := args.Forms
+		tidy := len(forms) > 0 && forms[0] == ":tidy"
+		if tidy {
+			forms = forms[1:]
+		}
+		var form string
+		switch {
+		case len(forms) > 1:
+			r.commandError("Usage: %s", r.commandUsage(cmd))
+			return fmt.Errorf("wrong number of arguments to %s%s", r.prefix(), expander)
+		case len(forms) == 1:
+			form = forms[0]
+		case len(r.history) > 0:
+			// the last input may consist of more than one form
+			last, err := splitForms(r.history[len(r.history)-1].Code)
+			if err != nil || len(last) == 0 {
+				r.commandError("No form to expand")
+				return errors.New("no form to expand")
+			}
+			form = last[len(last)-1]
+		default:
+			r.commandError("No form to expand")
+			return errors.New("no form to expand")
+		}
+		return r.Macroexpand(expander, form, tidy)
+	}
+	return cmd
+}
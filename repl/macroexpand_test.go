@@ -0,0 +1,55 @@
+package repl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMacroexpandWithOp(t *testing.T) {
+	repl, c := setupOpRepl(map[string][]map[string]interface{}{
+		"macroexpand": {{"expansion": "(if x (do y) nil)\n"}},
+	})
+	assert.Nil(t, repl.RunCommand("macroexpand-1", ":tidy (when x y)"))
+	expected := map[string]interface{}{
+		"op":                 "macroexpand",
+		"expander":           "macroexpand-1",
+		"code":               "(when x y)",
+		"ns":                 "user",
+		"display-namespaces": "tidy",
+	}
+	assert.Equal(t, expected, c.reqs[0])
+	assert.Equal(t, "(if x (do y) nil)\n", c.outs.String())
+
+	c.resps["macroexpand"] = []map[string]interface{}{{"status": []bencode.Datum{"done", "macroexpand-error"}}}
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("macroexpand", "(when)"))
+	assert.Equal(t, "Failed to expand (when)\n", c.outs.String())
+
+	c.resps["macroexpand"] = []map[string]interface{}{{"status": []bencode.Datum{"done", "macroexpand-error"}, "ex": "class clojure.lang.ArityException"}}
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("macroexpand", "(when)"))
+	assert.Equal(t, "Failed to expand (when) (class clojure.lang.ArityException)\n", c.outs.String())
+}
+
+func TestMacroexpandByEval(t *testing.T) {
+	c := newMockClient(step{})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	assert.NotNil(t, repl.RunCommand("macroexpand-all", ""))
+	assert.Equal(t, "No form to expand\n", c.outs.String())
+
+	repl.history = []*historyEntry{{Code: "(def x 1) (when x (println x))"}}
+	c.step = step{fmt.Sprintf(macroexpandCode, "clojure.walk/macroexpand-all", "(when x (println x))", false), func(ch chan<- client.EvalResult) {
+		ch <- `"(if x (do (clojure.core/println x)) nil)\n"`
+	}}
+	c.outs.Reset()
+	assert.Nil(t, repl.RunCommand("macroexpand-all", ""))
+	assert.Equal(t, "(if x (do (clojure.core/println x)) nil)\n", c.outs.String())
+
+	c.outs.Reset()
+	assert.NotNil(t, repl.RunCommand("macroexpand", ":tidy (a) (b)"))
+	assert.Equal(t, "Usage: ,macroexpand [:tidy] [FORM]\n", c.outs.String())
+}
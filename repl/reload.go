@@ -0,0 +1,217 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/watcher"
+	"github.com/fatih/color"
+	"olympos.io/encoding/edn"
+)
+
+// refreshCode calls clojure.tools.namespace.repl/refresh if available, and
+// returns the namespaces reloaded and the triaged error as an EDN string.
+// The output of refresh is captured to know the namespaces to reload, and
+// the rest of it is printed as is.
+const refreshCode = `(when (try (require 'clojure.tools.namespace.repl) true (catch Throwable _ false))` +
+	` (let [out (java.io.StringWriter.)` +
+	` res (binding [*out* out] ((resolve 'clojure.tools.namespace.repl/refresh)))` +
+	` s (str out)` +
+	` reloading (some->> (re-find #"(?m)^:reloading (\([^)]*\))" s) second read-string (map str))` +
+	` tracker @(resolve 'clojure.tools.namespace.repl/refresh-tracker)` +
+	` error-ns (some-> (:clojure.tools.namespace.reload/error-ns tracker) str)]` +
+	` (print (.replaceAll s "(?m)^:(reloading|error-while-loading) .*\n" ""))` +
+	` (flush)` +
+	` (binding [` + client.PrintBindings + `]` +
+	` (pr-str` +
+	` (if (instance? Throwable res)` +
+	` (let [triage (resolve 'clojure.main/ex-triage)` +
+	` ex-str (resolve 'clojure.main/ex-str)` +
+	` t (when triage (triage (Throwable->map res)))]` +
+	` (when (thread-bound? #'*e) (set! *e res))` +
+	` {:reloaded (vec (take-while #(not= % error-ns) reloading))` +
+	` :error-ns (str error-ns)` +
+	` :error (into {} (remove (comp nil? val))` +
+	` {:message (if (and t ex-str) (ex-str t) (str res))` +
+	` :class (some-> (:clojure.error/class t) str)` +
+	` :phase (some-> (:clojure.error/phase t) name)` +
+	` :source (:clojure.error/source t)` +
+	` :line (:clojure.error/line t)` +
+	` :column (:clojure.error/column t)})})` +
+	` {:reloaded (vec reloading)})))))`
+
+type (
+	refreshData struct {
+		Reloaded []string          `edn:"reloaded"`
+		ErrorNS  string            `edn:"error-ns"`
+		Error    *refreshErrorData `edn:"error"`
+	}
+
+	refreshErrorData struct {
+		Message string `edn:"message"`
+		Class   string `edn:"class"`
+		Phase   string `edn:"phase"`
+		Source  string `edn:"source"`
+		Line    int    `edn:"line"`
+		Column  int    `edn:"column"`
+	}
+)
+
+// trackLoadedFile remembers the file loaded in this session along with its
+// modification time, so that it can be reloaded once changed.
+func (r *Repl) trackLoadedFile(filename string) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.loadedFiles == nil {
+		r.loadedFiles = map[string]os.FileInfo{}
+	}
+	r.loadedFiles[path] = info
+}
+
+// changedFiles returns the files loaded in this session that still exist,
+// and the ones among them changed since they were loaded.
+func (r *Repl) changedFiles() (paths, changed []string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for path, loaded := range r.loadedFiles {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, path)
+		if !info.ModTime().Equal(loaded.ModTime()) || info.Size() != loaded.Size() {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(paths)
+	sort.Strings(changed)
+	return
+}
+
+// reportWriter is where the results of commands are reported. It is stderr
+// in JSON mode to keep stdout clean for events.
+func (r *Repl) reportWriter() io.Writer {
+	if r.events != nil {
+		return r.err
+	}
+	return r.out
+}
+
+func (r *Repl) reportReloaded(ns string) {
+	r.printer.With(color.FgGreen).Fprintf(r.reportWriter(), "  ok     %s\n", ns)
+}
+
+func (r *Repl) reportReloadFailure(ns string) {
+	r.printer.With(color.FgRed).Fprintf(r.reportWriter(), "  FAILED %s\n", ns)
+}
+
+// Reload reloads the changed namespaces in dependency order, via
+// clojure.tools.namespace.repl/refresh if it's available on the server, or
+// by reloading the files loaded in this session otherwise. It returns the
+// error that occurred while reloading, if any.
+//
+// The latter has nothing to reload in a fresh session, as in the reload
+// command without paths, since no files have been loaded to track changes
+// of. ReloadFiles is for that case.
+func (r *Repl) Reload() error {
+	value, err := r.EvalForValue(refreshCode)
+	if err != nil {
+		return err
+	}
+	if value == "nil" {
+		paths, changed := r.changedFiles()
+		if len(paths) == 0 {
+			fmt.Fprintln(r.reportWriter(), "No files to reload. clojure.tools.namespace is not available, and no files have been loaded in this session to track changes of. Specify the files or directories to load instead.")
+			return nil
+		}
+		return r.reloadFiles(paths, changed)
+	}
+	var s string
+	var data refreshData
+	if err := edn.UnmarshalString(value, &s); err != nil {
+		return fmt.Errorf("failed to parse reload results (%w)", err)
+	}
+	if err := edn.UnmarshalString(s, &data); err != nil {
+		return fmt.Errorf("failed to parse reload results (%w)", err)
+	}
+	if len(data.Reloaded) == 0 && data.Error == nil {
+		fmt.Fprintln(r.reportWriter(), "No namespaces to reload.")
+		return nil
+	}
+	for _, ns := range data.Reloaded {
+		r.reportReloaded(ns)
+	}
+	if data.Error == nil {
+		return nil
+	}
+	r.reportReloadFailure(data.ErrorNS)
+	r.Err(data.Error.Message + "\n")
+	return client.NewRuntimeErrorWithDetails(data.Error.Message, &client.ErrorDetails{
+		Class:  data.Error.Class,
+		Phase:  data.Error.Phase,
+		Source: data.Error.Source,
+		Line:   data.Error.Line,
+		Column: data.Error.Column,
+	})
+}
+
+// ReloadFiles loads all the source files under the paths in dependency
+// order. Unlike Reload, it doesn't know which files have changed since the
+// server loaded them, and so loads the unchanged ones as well.
+func (r *Repl) ReloadFiles(paths []string) error {
+	w, err := watcher.New(paths)
+	if err != nil {
+		r.errHandler.HandleErr(err)
+		return err
+	}
+	files := w.Files()
+	if len(files) == 0 {
+		fmt.Fprintln(r.reportWriter(), "No files to reload.")
+		return nil
+	}
+	return r.loadInOrder(w, files)
+}
+
+// reloadFiles loads the changed files along with the files depending on
+// them among the paths.
+func (r *Repl) reloadFiles(paths, changed []string) error {
+	if len(changed) == 0 {
+		fmt.Fprintln(r.reportWriter(), "No namespaces to reload.")
+		return nil
+	}
+	w, err := watcher.New(paths)
+	if err != nil {
+		r.errHandler.HandleErr(err)
+		return err
+	}
+	return r.loadInOrder(w, changed)
+}
+
+// loadInOrder loads the files in dependency order, and stops at the first
+// failure since the files depending on it would fail as well.
+func (r *Repl) loadInOrder(w *watcher.Watcher, files []string) error {
+	for _, path := range w.ReloadOrder(files) {
+		name := w.Namespace(path)
+		if name == "" {
+			name = path
+		}
+		if err := r.LoadWithResultVisibility(path, true); err != nil {
+			r.reportReloadFailure(name)
+			return err
+		}
+		r.reportReloaded(name)
+	}
+	return nil
+}
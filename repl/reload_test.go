@@ -0,0 +1,146 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type loadingClient struct {
+	*mockClient
+	loaded  []string
+	failing string
+}
+
+func (c *loadingClient) Load(filename string, content string) <-chan client.EvalResult {
+	c.loaded = append(c.loaded, filepath.Base(filename))
+	ch := make(chan client.EvalResult, 1)
+	if filepath.Base(filename) == c.failing {
+		ch <- client.NewRuntimeError("Syntax error compiling")
+	} else {
+		ch <- "nil"
+	}
+	close(ch)
+	return ch
+}
+
+func setupReloadRepl(value string) (*Repl, *loadingClient) {
+	c := &loadingClient{mockClient: newMockClient(step{refreshCode, func(ch chan<- client.EvalResult) {
+		ch <- value
+	}})}
+	repl := setupRepl(newMockReader(make(chan string)), c.mockClient)
+	repl.client = c
+	return repl, c
+}
+
+func TestReloadWithRefresh(t *testing.T) {
+	repl, c := setupReloadRepl(`"{:reloaded [\"foo.util\" \"foo.core\"]}"`)
+	assert.Nil(t, repl.Reload())
+	assert.Equal(t, "  ok     foo.util\n  ok     foo.core\n", c.outs.String())
+
+	repl, c = setupReloadRepl(`"{:reloaded [\"foo.util\"], :error-ns \"foo.core\", :error {:message \"Syntax error compiling at (foo/core.clj:3:1).\nUnable to resolve symbol: x in this context\", :class \"clojure.lang.Compiler$CompilerException\", :phase \"compile-syntax-check\", :source \"foo/core.clj\", :line 3, :column 1}}"`)
+	err := repl.Reload()
+	assert.Equal(t, client.NewRuntimeErrorWithDetails(
+		"Syntax error compiling at (foo/core.clj:3:1).\nUnable to resolve symbol: x in this context",
+		&client.ErrorDetails{
+			Class:  "clojure.lang.Compiler$CompilerException",
+			Phase:  "compile-syntax-check",
+			Source: "foo/core.clj",
+			Line:   3,
+			Column: 1,
+		},
+	), err)
+	assert.Equal(t, "  ok     foo.util\n  FAILED foo.core\n", c.outs.String())
+	assert.Equal(t, "Syntax error compiling at (foo/core.clj:3:1).\nUnable to resolve symbol: x in this context\n", c.errs.String())
+
+	repl, c = setupReloadRepl(`"{:reloaded []}"`)
+	assert.Nil(t, repl.Reload())
+	assert.Equal(t, "No namespaces to reload.\n", c.outs.String())
+}
+
+func TestReloadAlias(t *testing.T) {
+	tests := []struct {
+		prefix string
+		input  string
+	}{
+		{"", ":reload"},
+		{"", ",reload"},
+		{":repl/", ":reload"},
+		{":repl/", ":repl/reload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			in := make(chan string)
+			repl, c := setupReloadRepl(`"{:reloaded [\"foo.core\"]}"`)
+			repl.in = newReader(newMockReader(in))
+			repl.commandPrefix = tt.prefix
+			done := make(chan struct{})
+			go func() {
+				repl.Start()
+				close(done)
+			}()
+			in <- tt.input + "\n"
+			// quitting by EOF rather than :repl/quit, which could be
+			// taken as stdin while reloading
+			close(in)
+			<-done
+			assert.Equal(t, "user=>   ok     foo.core\nuser=> ", c.outs.String())
+		})
+	}
+}
+
+func TestReloadTrackedFiles(t *testing.T) {
+	dir := t.TempDir()
+	core := filepath.Join(dir, "core.clj")
+	util := filepath.Join(dir, "util.clj")
+	other := filepath.Join(dir, "other.clj")
+	testutil.WriteFile(t, core, "(ns foo.core (:require [foo.util]))")
+	testutil.WriteFile(t, util, "(ns foo.util)")
+	testutil.WriteFile(t, other, "(ns foo.other)")
+
+	repl, c := setupReloadRepl("nil")
+	assert.Nil(t, repl.Reload())
+	assert.Contains(t, c.outs.String(), "No files to reload.")
+
+	for _, path := range []string{core, util, other} {
+		assert.Nil(t, repl.LoadWithResultVisibility(path, true))
+	}
+	c.loaded = nil
+	c.outs.Reset()
+	assert.Nil(t, repl.Reload())
+	assert.Equal(t, "No namespaces to reload.\n", c.outs.String())
+	assert.Empty(t, c.loaded)
+
+	testutil.WriteFile(t, util, "(ns foo.util) (def x 1)")
+	future := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(util, future, future))
+	c.outs.Reset()
+	assert.Nil(t, repl.Reload())
+	assert.Equal(t, []string{"util.clj", "core.clj"}, c.loaded)
+	assert.Equal(t, "  ok     foo.util\n  ok     foo.core\n", c.outs.String())
+
+	// reloaded files are no longer considered changed
+	c.loaded = nil
+	c.outs.Reset()
+	assert.Nil(t, repl.Reload())
+	assert.Empty(t, c.loaded)
+}
+
+func TestReloadFiles(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFile(t, filepath.Join(dir, "a", "core.clj"), "(ns foo.core (:require [foo.util]))")
+	testutil.WriteFile(t, filepath.Join(dir, "b", "util.clj"), "(ns foo.util)")
+	testutil.WriteFile(t, filepath.Join(dir, "b", "handler.clj"), "(ns foo.handler (:require [foo.core]))")
+
+	repl, c := setupReloadRepl("nil")
+	c.failing = "core.clj"
+	err := repl.ReloadFiles([]string{dir})
+	assert.Equal(t, client.NewRuntimeError("Syntax error compiling"), err)
+	assert.Equal(t, []string{"util.clj", "core.clj"}, c.loaded)
+	assert.Equal(t, "  ok     foo.util\n  FAILED foo.core\n", c.outs.String())
+}
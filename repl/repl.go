@@ -7,20 +7,46 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 
 	"github.com/athos/trenchman/client"
 	"github.com/fatih/color"
 )
 
 type Repl struct {
-	client     client.Client
-	in         *interruptibleReader
-	out        io.Writer
-	err        io.Writer
-	printer    Printer
-	errHandler client.ErrorHandler
-	lineBuffer *lineBuffer
-	hidesNil   bool
+	client        client.Client
+	in            *interruptibleReader
+	out           io.Writer
+	err           io.Writer
+	printer       Printer
+	errHandler    client.ErrorHandler
+	lineBuffer    *lineBuffer
+	hidesNil      bool
+	events        *eventWriter
+	recorder      *eventWriter
+	triagesErrors bool
+	// stdinDetached is true while the input is not forwarded to the
+	// server as stdin
+	stdinDetached bool
+	reconnect     ClientFactory
+	initFiles     []string
+	loadedFiles   map[string]os.FileInfo
+	commandPrefix string
+	commands      []*Command
+	history       []*historyEntry
+	lock          sync.RWMutex
+	generation    int
+	disconnected  chan struct{}
+	// reconnecting is closed when the reconnection in progress completes,
+	// or nil if not reconnecting
+	reconnecting chan struct{}
+}
+
+// connErrHandler tells which client an error came from, so that errors
+// from clients already replaced on reconnection can be ignored.
+type connErrHandler struct {
+	repl       *Repl
+	generation int
 }
 
 type Opts struct {
@@ -30,66 +56,335 @@ type Opts struct {
 	Printer    Printer
 	ErrHandler client.ErrorHandler
 	HidesNil   bool
+	InitNS     string
+	// JSON makes the REPL emit results and outputs as newline-delimited
+	// JSON events to Out, without prompts.
+	JSON bool
+	// Reconnect is used to create a new client when disconnected from
+	// the server. If nil, disconnection is reported to ErrHandler instead.
+	Reconnect ClientFactory
+	// CommandPrefix is the prefix of REPL commands. Defaults to
+	// DefaultCommandPrefix.
+	CommandPrefix string
+	// Commands are the user-defined REPL commands in addition to the
+	// built-in ones.
+	Commands []*Command
+	// Record is where the transcript of the session is written as
+	// newline-delimited JSON events with timestamps, if not nil.
+	Record io.Writer
+	// TriagesErrors makes the REPL ask the server for the details of
+	// evaluation errors, such as the phase, even when neither JSON events
+	// nor a transcript need them, e.g. to choose the exit status.
+	TriagesErrors bool
+}
+
+type ClientOpts struct {
+	InitNS        string
+	OutputHandler client.OutputHandler
+	ErrorHandler  client.ErrorHandler
 }
 
-func NewRepl(
-	opts *Opts,
-	factory func(client.OutputHandler) client.Client,
-) *Repl {
+type ClientFactory func(*ClientOpts) (client.Client, error)
+
+func NewRepl(opts *Opts, factory ClientFactory) *Repl {
 	repl := &Repl{
-		in:         newReader(opts.In),
-		out:        opts.Out,
-		err:        opts.Err,
-		printer:    opts.Printer,
-		errHandler: opts.ErrHandler,
-		lineBuffer: &lineBuffer{},
-		hidesNil:   opts.HidesNil,
-	}
-	client := factory(repl)
+		in:            newReader(opts.In),
+		out:           opts.Out,
+		err:           opts.Err,
+		printer:       opts.Printer,
+		errHandler:    opts.ErrHandler,
+		lineBuffer:    &lineBuffer{},
+		hidesNil:      opts.HidesNil,
+		reconnect:     opts.Reconnect,
+		disconnected:  make(chan struct{}),
+		commandPrefix: opts.CommandPrefix,
+		commands:      opts.Commands,
+		triagesErrors: opts.TriagesErrors,
+	}
+	if opts.JSON {
+		repl.events = newEventWriter(opts.Out)
+	}
+	if opts.Record != nil {
+		repl.recorder = newEventWriter(opts.Record)
+	}
+	client, err := factory(repl.clientOpts(0, opts.InitNS))
+	if err != nil {
+		repl.errHandler.HandleErr(err)
+		return nil
+	}
 	repl.client = client
 	return repl
 }
 
+func (r *Repl) clientOpts(generation int, initNS string) *ClientOpts {
+	return &ClientOpts{
+		InitNS:        initNS,
+		OutputHandler: r,
+		ErrorHandler:  &connErrHandler{r, generation},
+	}
+}
+
+// currentClient returns the client, waiting for the reconnection in
+// progress, if any.
+func (r *Repl) currentClient() client.Client {
+	for {
+		r.lock.RLock()
+		c, reconnecting := r.client, r.reconnecting
+		r.lock.RUnlock()
+		if reconnecting == nil {
+			return c
+		}
+		<-reconnecting
+	}
+}
+
+func (r *Repl) disconnectedCh() <-chan struct{} {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.disconnected
+}
+
 func (r *Repl) Close() error {
 	if err := r.in.Close(); err != nil {
 		return err
 	}
-	return r.client.Close()
+	return r.currentClient().Close()
 }
 
 func (r *Repl) SupportsOp(op string) bool {
-	return r.client.SupportsOp(op)
+	return r.currentClient().SupportsOp(op)
+}
+
+// SendOp sends the op to the server, and returns the channel that receives
+// the responses to it. It returns false if the client can't send arbitrary
+// ops.
+func (r *Repl) SendOp(req map[string]interface{}) (<-chan map[string]interface{}, bool) {
+	sender, ok := r.currentClient().(client.OpSender)
+	if !ok {
+		return nil, false
+	}
+	return sender.SendOp(req), true
 }
 
 func (r *Repl) Out(s string) {
+	r.record(&Event{Type: EventOut, Text: s})
+	if r.events != nil {
+		r.events.write(&Event{Type: EventOut, Text: s})
+		return
+	}
 	r.printer.With(color.FgYellow).Fprint(r.out, s)
 }
 
 func (r *Repl) Err(s string) {
+	r.record(&Event{Type: EventErr, Text: s})
+	if r.events != nil {
+		r.events.write(&Event{Type: EventErr, Text: s})
+		return
+	}
 	r.printer.With(color.FgRed).Fprint(r.err, s)
 }
 
+// ReportsExceptions returns true in JSON mode, where evaluation errors are
+// reported as exception events instead of err output.
+func (r *Repl) ReportsExceptions() bool {
+	return r.events != nil
+}
+
 func (r *Repl) Debug(s string) {
 	r.printer.With(color.FgHiBlue).Fprint(r.err, s)
 }
 
-func (r *Repl) handleResults(ch <-chan client.EvalResult, hidesResult bool) {
+func (r *Repl) info(s string) {
+	r.printer.With(color.FgMagenta).Fprint(r.err, s)
+}
+
+func (h *connErrHandler) HandleErr(err error) {
+	h.repl.handleConnErr(h.generation, err)
+}
+
+func (r *Repl) handleConnErr(generation int, err error) {
+	if r.reconnect == nil {
+		r.errHandler.HandleErr(err)
+		return
+	}
+	r.lock.Lock()
+	if generation != r.generation {
+		r.lock.Unlock()
+		return
+	}
+	if !client.IsDisconnected(err) {
+		r.lock.Unlock()
+		r.errHandler.HandleErr(err)
+		return
+	}
+	r.generation++
+	generation = r.generation
+	close(r.disconnected)
+	r.disconnected = make(chan struct{})
+	reconnecting := make(chan struct{})
+	r.reconnecting = reconnecting
+	old := r.client
+	r.lock.Unlock()
+	r.reconnectToServer(generation, old, reconnecting)
+}
+
+// reconnectToServer replaces the old client with a new one connected to
+// the server, restoring the current namespace and re-running the init
+// files. Evaluations in progress are abandoned. The lock must not be held,
+// since the new client may report errors while connecting or loading the
+// init files.
+func (r *Repl) reconnectToServer(generation int, old client.Client, reconnecting chan struct{}) {
+	done := func() {
+		r.lock.Lock()
+		if r.reconnecting == reconnecting {
+			r.reconnecting = nil
+		}
+		r.lock.Unlock()
+		close(reconnecting)
+	}
+	ns := old.CurrentNS()
+	old.Close()
+	r.info("Disconnected from server. Reconnecting...\n")
+	c, err := r.reconnect(r.clientOpts(generation, ns))
+	if err != nil {
+		done()
+		r.errHandler.HandleErr(fmt.Errorf("could not reconnect to server (%w)", err))
+		return
+	}
+	r.lock.Lock()
+	if generation != r.generation {
+		// disconnected again while connecting
+		r.lock.Unlock()
+		c.Close()
+		done()
+		return
+	}
+	r.client = c
+	r.lock.Unlock()
+	done()
+	for _, filename := range r.initFiles {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			r.errHandler.HandleErr(err)
+			return
+		}
+		ok, err := r.loadOnReconnection(c, filename, string(content))
+		if !ok {
+			return
+		}
+		if err != nil {
+			r.printer.With(color.FgRed).Fprintf(r.err, "Failed to load %s on reconnection (%s)\n", filename, strings.TrimSpace(err.Error()))
+		}
+	}
+	r.info(fmt.Sprintf("Reconnected to server (ns: %s).\n", c.CurrentNS()))
+}
+
+// loadOnReconnection loads the init file, and returns the first error that
+// occurred, if any. Unlike handleResults, it doesn't read stdin, since the
+// REPL may be reading input concurrently. It returns false if disconnected
+// again while loading.
+func (r *Repl) loadOnReconnection(c client.Client, filename, content string) (bool, error) {
+	disconnected := r.disconnectedCh()
+	ch := c.Load(filename, content)
+	var err error
+	for {
+		select {
+		case <-disconnected:
+			return false, nil
+		case res, ok := <-ch:
+			if !ok {
+				return true, err
+			}
+			if e, ok := res.(*client.RuntimeError); ok && err == nil {
+				err = e
+			}
+		}
+	}
+}
+
+// handleResults prints the results and returns the last value along with
+// the first error that occurred, if any. Once the evaluation completes, the
+// last error is triaged if its details are not available yet, since the
+// server only keeps the last one as *e.
+func (r *Repl) handleResults(ch <-chan client.EvalResult, hidesResult bool) (value string, err error) {
+	disconnected := r.disconnectedCh()
+	// In JSON mode, once an error that needs triaging occurs, the events
+	// for the rest of the results are held back until the evaluation
+	// completes, so that the events are written in order with the
+	// exception event including the triaged details
+	var held []*Event
+	var last *client.RuntimeError
+	var lastEvent *Event
+	write := func(event *Event) {
+		if held != nil {
+			held = append(held, event)
+		} else {
+			r.events.write(event)
+		}
+	}
+	flush := func() {
+		for _, event := range held {
+			r.events.write(event)
+		}
+		held = nil
+	}
 	for {
 		select {
+		case <-disconnected:
+			if err == nil {
+				err = client.ErrDisconnected
+			}
+			if r.events != nil {
+				flush()
+			}
+			return
 		case res, ok := <-ch:
 			if !ok {
+				if last != nil && r.needsTriage(last) {
+					triaged := r.triage(last)
+					if err == last {
+						err = triaged
+					}
+					if lastEvent != nil {
+						*lastEvent = *exceptionEvent(triaged)
+					}
+				}
+				if r.events != nil {
+					flush()
+				}
 				return
 			}
-			if s, ok := res.(string); ok {
-				if !hidesResult && (!r.hidesNil || s != "nil") {
-					fmt.Fprintln(r.out, s)
+			switch res := res.(type) {
+			case string:
+				value = res
+				if !hidesResult {
+					r.record(valueEvent(r.currentClient().CurrentNS(), res))
+				}
+				if r.events != nil {
+					if !hidesResult {
+						write(valueEvent(r.currentClient().CurrentNS(), res))
+					}
+				} else if !hidesResult && (!r.hidesNil || res != "nil") {
+					fmt.Fprintln(r.out, res)
+				}
+			case *client.RuntimeError:
+				if err == nil {
+					err = res
+				}
+				last = res
+				if r.events != nil {
+					if held == nil && r.needsTriage(res) {
+						held = []*Event{}
+					}
+					lastEvent = exceptionEvent(res)
+					write(lastEvent)
 				}
-			} else if _, ok := res.(*client.RuntimeError); !ok {
+			default:
 				panic("unexpected result received")
 			}
-		case res := <-r.in.readLine():
+		case res := <-r.stdin():
 			if s, ok := res.(string); ok {
-				r.client.Stdin(s)
+				r.currentClient().Stdin(s)
 			} else {
 				switch err := res.(error); err {
 				case io.EOF, errInterrupted:
@@ -101,11 +396,73 @@ func (r *Repl) handleResults(ch <-chan client.EvalResult, hidesResult bool) {
 	}
 }
 
-func (r *Repl) Eval(code string) {
-	r.handleResults(r.client.Eval(code), false)
+// stdin returns the channel of the lines to be sent to the server as
+// stdin. Nothing is sent while streaming, since the input is the code, or
+// while evaluating code for commands.
+func (r *Repl) stdin() <-chan interface{} {
+	if r.stdinDetached {
+		return nil
+	}
+	return r.in.readLine()
+}
+
+// needsTriage reports whether the details of the runtime error are used
+// but not available yet. Triaging costs a round trip to the server, so
+// the details are only asked for when they are emitted as events,
+// recorded, or asked for with TriagesErrors.
+func (r *Repl) needsTriage(err *client.RuntimeError) bool {
+	if r.events == nil && r.recorder == nil && !r.triagesErrors {
+		return false
+	}
+	details := err.Details()
+	return details == nil || details.Phase == ""
+}
+
+// triage fills in the details of the runtime error by asking the server,
+// if they are needed and not available yet. The error is returned as is
+// if triaging fails.
+func (r *Repl) triage(err *client.RuntimeError) *client.RuntimeError {
+	if !r.needsTriage(err) {
+		return err
+	}
+	triager, ok := r.currentClient().(client.ErrorTriager)
+	if !ok {
+		return err
+	}
+	details, e := triager.TriageLastError()
+	if e != nil || details == nil {
+		return err
+	}
+	return client.NewRuntimeErrorWithDetails(err.Error(), details)
+}
+
+// Eval evaluates the code and returns the first error that occurred
+// during evaluation, if any.
+func (r *Repl) Eval(code string) error {
+	r.recordInput(code)
+	_, err := r.handleResults(r.currentClient().Eval(code), false)
+	r.recordError(err)
+	return err
+}
+
+// EvalForValue evaluates the code without printing the result, and
+// returns the value of the last form.
+func (r *Repl) EvalForValue(code string) (string, error) {
+	return r.handleResults(r.currentClient().Eval(code), true)
+}
+
+// evalForCommand evaluates the code that a command uses internally, such
+// as a lookup of a var, and returns the value. The input is not read to be
+// forwarded as stdin, so that no read is left pending on the terminal when
+// the command goes on to run a program reading it, e.g. an editor.
+func (r *Repl) evalForCommand(code string) (string, error) {
+	detached := r.stdinDetached
+	r.stdinDetached = true
+	defer func() { r.stdinDetached = detached }()
+	return r.EvalForValue(code)
 }
 
-func (r *Repl) LoadWithResultVisibility(filename string, hidesResult bool) {
+func (r *Repl) LoadWithResultVisibility(filename string, hidesResult bool) error {
 	var reader *bufio.Reader
 	if filename == "-" {
 		reader = bufio.NewReader(os.Stdin)
@@ -113,33 +470,109 @@ func (r *Repl) LoadWithResultVisibility(filename string, hidesResult bool) {
 		file, err := os.Open(filename)
 		if err != nil {
 			r.errHandler.HandleErr(err)
+			return err
 		}
+		defer file.Close()
 		reader = bufio.NewReader(file)
 	}
 	content, err := io.ReadAll(reader)
 	if err != nil {
 		r.errHandler.HandleErr(err)
+		return err
 	}
-	r.handleResults(r.client.Load(filename, string(content)), hidesResult)
+	if filename != "-" {
+		r.trackLoadedFile(filename)
+	}
+	if !hidesResult {
+		r.recordInput(loadInput(filename, string(content)))
+	}
+	_, err = r.handleResults(r.currentClient().Load(filename, string(content)), hidesResult)
+	if !hidesResult {
+		r.recordError(err)
+	}
+	return err
+}
+
+func (r *Repl) Load(filename string) error {
+	return r.LoadWithResultVisibility(filename, false)
 }
 
-func (r *Repl) Load(filename string) {
-	r.LoadWithResultVisibility(filename, false)
+// LoadInit loads the file without printing the result, and remembers it
+// so that it will be loaded again on reconnection.
+func (r *Repl) LoadInit(filename string) error {
+	err := r.LoadWithResultVisibility(filename, true)
+	if filename != "-" {
+		r.initFiles = append(r.initFiles, filename)
+	}
+	return err
+}
+
+// EvalStream reads forms from the input and evaluates each of them as soon
+// as it is complete. It stops at the first error unless keepGoing is true,
+// and returns the first error that occurred.
+func (r *Repl) EvalStream(keepGoing bool) error {
+	r.stdinDetached = true
+	defer func() { r.stdinDetached = false }()
+	buf := &formBuffer{}
+	var firstErr error
+	for {
+		var forms []string
+		var err error
+		eof := false
+		switch res := (<-r.in.readLine()).(type) {
+		case string:
+			forms, err = buf.feed(res)
+		case error:
+			if res != io.EOF {
+				return res
+			}
+			eof = true
+			forms, err = buf.flush()
+		}
+		for _, form := range forms {
+			if e := r.Eval(form); e != nil {
+				if !keepGoing {
+					return e
+				}
+				if firstErr == nil {
+					firstErr = e
+				}
+			}
+		}
+		if err != nil {
+			err = client.NewRuntimeErrorWithDetails(err.Error(), &client.ErrorDetails{Phase: "read-source"})
+			r.Err(fmt.Sprintf("Syntax error reading source (%s)\n", err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			return firstErr
+		}
+		if eof {
+			return firstErr
+		}
+	}
 }
 
 func (r *Repl) Interrupt() {
-	r.client.Interrupt()
+	r.currentClient().Interrupt()
 	r.in.interrupt()
 }
 
+func (r *Repl) printPrompt(continued bool) {
+	ns := r.currentClient().CurrentNS()
+	if continued {
+		prompt := strings.Repeat(" ", len(ns)-2) + "#_=> "
+		r.printer.With(color.FgGreen).Fprint(r.out, prompt)
+	} else {
+		r.printer.With(color.FgGreen).Fprintf(r.out, "%s=> ", ns)
+	}
+}
+
 func (r *Repl) Start() {
 	continued := false
 	for {
-		if continued {
-			prompt := strings.Repeat(" ", len(r.client.CurrentNS())-2) + "#_=> "
-			r.printer.With(color.FgGreen).Fprint(r.out, prompt)
-		} else {
-			r.printer.With(color.FgGreen).Fprintf(r.out, "%s=> ", r.client.CurrentNS())
+		if r.events == nil {
+			r.printPrompt(continued)
 		}
 		res := <-r.in.readLine()
 		switch res := res.(type) {
@@ -170,8 +603,18 @@ func (r *Repl) Start() {
 				continue
 			case ":repl/quit":
 				return
+			case ":reload":
+				// alias of the reload command, regardless of the prefix
+				r.RunCommand("reload", "")
+				continue
+			}
+			if name, args, ok := r.parseCommand(code); ok {
+				if err := r.RunCommand(name, args); err == errQuit {
+					return
+				}
+				continue
 			}
-			r.Eval(code)
+			r.evalAndRecord(code)
 		}
 	}
 }
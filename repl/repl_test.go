@@ -2,8 +2,11 @@ package repl
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -14,10 +17,12 @@ import (
 type (
 	mockClient struct {
 		step        step
+		load        func(chan<- client.EvalResult)
 		ins         []string
 		outs        *bytes.Buffer
 		errs        *bytes.Buffer
 		interrupted bool
+		closed      bool
 	}
 
 	step struct {
@@ -47,7 +52,15 @@ func (c *mockClient) Eval(code string) <-chan client.EvalResult {
 }
 
 func (c *mockClient) Load(filename string, content string) <-chan client.EvalResult {
-	return nil
+	if c.load == nil {
+		return nil
+	}
+	ch := make(chan client.EvalResult)
+	go func() {
+		c.load(ch)
+		close(ch)
+	}()
+	return ch
 }
 
 func (c *mockClient) Stdin(input string) {
@@ -59,6 +72,7 @@ func (c *mockClient) Interrupt() {
 }
 
 func (c *mockClient) Close() error {
+	c.closed = true
 	return nil
 }
 
@@ -225,3 +239,249 @@ func TestReplInterrupt(t *testing.T) {
 	assert.True(t, c.interrupted)
 	repl.Close()
 }
+
+func TestReplReconnect(t *testing.T) {
+	var errHandler client.ErrorHandler
+	inputCh := make(chan string, 1)
+	inputCh <- "(foo)\n"
+	r := newMockReader(inputCh)
+	c1 := newMockClient(step{
+		"(foo)",
+		func(ch chan<- client.EvalResult) {
+			errHandler.HandleErr(client.ErrDisconnected)
+			inputCh <- "(bar)\n"
+		},
+	})
+	c2 := newMockClient(step{
+		"(bar)",
+		func(ch chan<- client.EvalResult) {
+			ch <- "42"
+			r.Close()
+		},
+	})
+	out := new(bytes.Buffer)
+	errs := new(bytes.Buffer)
+	factory := func(c *mockClient) ClientFactory {
+		return func(opts *ClientOpts) (client.Client, error) {
+			assert.Equal(t, "user", opts.InitNS)
+			errHandler = opts.ErrorHandler
+			return c, nil
+		}
+	}
+	repl := NewRepl(&Opts{
+		In:        r,
+		Out:       out,
+		Err:       errs,
+		Printer:   NewMonochromePrinter(),
+		InitNS:    "user",
+		Reconnect: factory(c2),
+	}, factory(c1))
+	repl.Start()
+	assert.True(t, c1.closed)
+	assert.Equal(t, "user=> user=> 42\nuser=> ", out.String())
+	assert.Equal(t, "Disconnected from server. Reconnecting...\nReconnected to server (ns: user).\n", errs.String())
+	repl.Close()
+}
+
+func TestReplReconnectLoadsInitFiles(t *testing.T) {
+	var errHandler client.ErrorHandler
+	inputCh := make(chan string, 1)
+	inputCh <- "(foo)\n"
+	r := newMockReader(inputCh)
+	c1 := newMockClient(step{
+		"(foo)",
+		func(ch chan<- client.EvalResult) {
+			errHandler.HandleErr(client.ErrDisconnected)
+			inputCh <- "(bar)\n"
+		},
+	})
+	// c2 is disconnected while loading the init file, which must not
+	// block the reconnection to c3
+	c2 := newMockClient(step{})
+	c2.load = func(ch chan<- client.EvalResult) {
+		errHandler.HandleErr(client.ErrDisconnected)
+	}
+	c3 := newMockClient(step{
+		"(bar)",
+		func(ch chan<- client.EvalResult) {
+			ch <- "42"
+			r.Close()
+		},
+	})
+	c3.load = func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeError("Boom\n")
+	}
+	clients := []*mockClient{c1, c2, c3}
+	factory := func(opts *ClientOpts) (client.Client, error) {
+		c := clients[0]
+		clients = clients[1:]
+		errHandler = opts.ErrorHandler
+		return c, nil
+	}
+	out := new(bytes.Buffer)
+	errs := new(bytes.Buffer)
+	repl := NewRepl(&Opts{
+		In:        r,
+		Out:       out,
+		Err:       errs,
+		Printer:   NewMonochromePrinter(),
+		Reconnect: factory,
+	}, factory)
+	path := filepath.Join(t.TempDir(), "init.clj")
+	if err := os.WriteFile(path, []byte("(init)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repl.initFiles = []string{path}
+	repl.Start()
+	assert.True(t, c1.closed)
+	assert.True(t, c2.closed)
+	assert.Equal(t, "user=> user=> 42\nuser=> ", out.String())
+	assert.Equal(t, "Disconnected from server. Reconnecting...\n"+
+		"Disconnected from server. Reconnecting...\n"+
+		"Failed to load "+path+" on reconnection (Boom)\n"+
+		"Reconnected to server (ns: user).\n", errs.String())
+	repl.Close()
+}
+
+func TestReplEval(t *testing.T) {
+	r := newMockReader(make(chan string))
+	c := newMockClient(step{"(/ 1 0)", func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeError("divide by zero")
+	}})
+	repl := setupRepl(r, c)
+	assert.Equal(t, client.NewRuntimeError("divide by zero"), repl.Eval("(/ 1 0)"))
+
+	c.step = step{"(+ 1 2)", func(ch chan<- client.EvalResult) {
+		ch <- "3"
+	}}
+	value, err := repl.EvalForValue("(+ 1 2)")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", value)
+	assert.Equal(t, "", c.outs.String())
+	repl.Close()
+}
+
+func TestReplJSON(t *testing.T) {
+	var repl *Repl
+	r := newMockReader(make(chan string))
+	c := newMockClient(step{"(println 1) (/ 1 0) nil", func(ch chan<- client.EvalResult) {
+		repl.Out("1\n")
+		repl.Err("Execution error\n")
+		ch <- client.NewRuntimeErrorWithDetails("Divide by zero", &client.ErrorDetails{
+			Class:  "java.lang.ArithmeticException",
+			Phase:  "execution",
+			Source: "NO_SOURCE_FILE",
+			Line:   1,
+			Column: 13,
+		})
+		ch <- "nil"
+	}})
+	repl = setupRepl(r, c)
+	repl.events = newEventWriter(c.outs)
+	assert.NotNil(t, repl.Eval("(println 1) (/ 1 0) nil"))
+	assert.Equal(t,
+		`{"type":"out","text":"1\n"}
+{"type":"err","text":"Execution error\n"}
+{"type":"exception","message":"Divide by zero","class":"java.lang.ArithmeticException","phase":"execution","location":{"source":"NO_SOURCE_FILE","line":1,"column":13}}
+{"type":"value","ns":"user","value":"nil"}
+`,
+		c.outs.String(),
+	)
+	assert.Equal(t, "", c.errs.String())
+	repl.Close()
+}
+
+type triagingClient struct {
+	*mockClient
+	triaged int
+	err     error
+}
+
+func (c *triagingClient) TriageLastError() (*client.ErrorDetails, error) {
+	c.triaged++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &client.ErrorDetails{
+		Class: "java.lang.ArithmeticException",
+		Phase: "execution",
+	}, nil
+}
+
+func TestReplJSONTriage(t *testing.T) {
+	r := newMockReader(make(chan string))
+	c := &triagingClient{mockClient: newMockClient(step{"(/ 1 0) 42", func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeErrorWithDetails("Divide by zero", &client.ErrorDetails{
+			Class: "java.lang.ArithmeticException",
+		})
+		ch <- "42"
+	}})}
+	repl := setupRepl(r, c.mockClient)
+	repl.client = c
+	repl.events = newEventWriter(c.outs)
+	err := repl.Eval("(/ 1 0) 42")
+	assert.Equal(t, 1, c.triaged)
+	assert.Equal(t, "execution", err.(*client.RuntimeError).Details().Phase)
+	assert.Equal(t,
+		`{"type":"exception","message":"Divide by zero","class":"java.lang.ArithmeticException","phase":"execution"}
+{"type":"value","ns":"user","value":"42"}
+`,
+		c.outs.String(),
+	)
+	repl.Close()
+}
+
+func TestReplTriage(t *testing.T) {
+	tests := []struct {
+		title   string
+		setup   func(*Repl)
+		err     error
+		triaged int
+	}{
+		{"not triaged in plain text mode", func(*Repl) {}, nil, 0},
+		{"triaged for the exit status", func(r *Repl) { r.triagesErrors = true }, nil, 1},
+		{"triaged for the transcript", func(r *Repl) { r.recorder = newEventWriter(&bytes.Buffer{}) }, nil, 1},
+		{"raw error if triage fails", func(r *Repl) { r.triagesErrors = true }, errors.New("failed to clone the session"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			r := newMockReader(make(chan string))
+			c := &triagingClient{mockClient: newMockClient(step{"(/ 1 0)", func(ch chan<- client.EvalResult) {
+				ch <- client.NewRuntimeError("Divide by zero")
+			}}), err: tt.err}
+			repl := setupRepl(r, c.mockClient)
+			repl.client = c
+			tt.setup(repl)
+			err := repl.Eval("(/ 1 0)")
+			assert.EqualError(t, err, "Divide by zero")
+			assert.Equal(t, tt.triaged, c.triaged)
+			if tt.triaged > 0 && tt.err == nil {
+				assert.Equal(t, "execution", err.(*client.RuntimeError).Details().Phase)
+			} else {
+				assert.Nil(t, err.(*client.RuntimeError).Details())
+			}
+			repl.Close()
+		})
+	}
+}
+
+func TestReplEvalStream(t *testing.T) {
+	inputCh := make(chan string, 1)
+	r := newMockReader(inputCh)
+	c := newMockClient(step{})
+	c.step = step{"(foo)", func(ch chan<- client.EvalResult) {
+		ch <- "1"
+		c.step = step{"(bar\n 2)", func(ch chan<- client.EvalResult) {
+			ch <- "2"
+		}}
+		inputCh <- "(bar\n 2) )\n"
+	}}
+	repl := setupRepl(r, c)
+	inputCh <- "(foo) ;; comment\n"
+	err := repl.EvalStream(false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "1\n2\n", c.outs.String())
+	assert.Equal(t, "Syntax error reading source (unbalanced symbol found: ))\n", c.errs.String())
+	assert.Nil(t, c.ins)
+	repl.Close()
+}
@@ -0,0 +1,57 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/athos/trenchman/client"
+)
+
+// LoadScript loads the script file with *command-line-args* bound to args,
+// without printing the result.
+func (r *Repl) LoadScript(filename string, args []string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		r.errHandler.HandleErr(err)
+		return err
+	}
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		r.errHandler.HandleErr(err)
+		return err
+	}
+	_, err = r.EvalForValue(scriptInvocation(path, string(content), args))
+	return err
+}
+
+// stripShebang removes the shebang line, leaving the newline so that line
+// numbers are kept intact.
+func stripShebang(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return content
+	}
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		return content[i:]
+	}
+	return ""
+}
+
+// scriptInvocation builds the code to load the script with the arguments
+// bound to *command-line-args*.
+func scriptInvocation(path, content string, args []string) string {
+	argList := "nil"
+	if len(args) > 0 {
+		quotedArgs := make([]string, len(args))
+		for i, arg := range args {
+			quotedArgs[i] = client.QuoteString(arg)
+		}
+		argList = fmt.Sprintf("(list %s)", strings.Join(quotedArgs, " "))
+	}
+	return fmt.Sprintf(
+		"(binding [*command-line-args* %s] %s)",
+		argList,
+		client.LoadFileCode(path, stripShebang(content)),
+	)
+}
@@ -0,0 +1,29 @@
+package repl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptInvocation(t *testing.T) {
+	tests := []struct {
+		content  string
+		args     []string
+		expected string
+	}{
+		{
+			"(println *command-line-args*)\n",
+			nil,
+			`(binding [*command-line-args* nil] (clojure.lang.Compiler/load (java.io.StringReader. "(println *command-line-args*)\n") "/tmp/hello.clj" "hello.clj"))`,
+		},
+		{
+			"#!/usr/bin/env -S trench --script\n(println \"Hello\\n\")\n",
+			[]string{"foo", "\"bar\""},
+			`(binding [*command-line-args* (list "foo" "\"bar\"")] (clojure.lang.Compiler/load (java.io.StringReader. "\n(println \"Hello\\n\")\n") "/tmp/hello.clj" "hello.clj"))`,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, scriptInvocation("/tmp/hello.clj", tt.content, tt.args))
+	}
+}
@@ -0,0 +1,165 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// sourceDirs are the directories where the files relative to the classpath
+// are looked for in the current directory.
+var sourceDirs = []string{"src", "test", "dev", "src/main/clojure", "src/test/clojure", "."}
+
+// localSourcePath returns the path to the local file where the var is
+// defined, or "" if the file is not available locally (e.g. in a jar).
+func localSourcePath(info *symbolInfo) string {
+	file := info.File
+	if strings.HasPrefix(file, "file:") {
+		if u, err := url.Parse(file); err == nil && u.Path != "" {
+			file = u.Path
+		} else {
+			file = strings.TrimPrefix(file, "file:")
+		}
+	}
+	if filepath.IsAbs(file) {
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	rel := info.Resource
+	if rel == "" && !filepath.IsAbs(file) && !strings.Contains(file, ":") {
+		rel = file
+	}
+	if rel == "" {
+		return ""
+	}
+	for _, dir := range sourceDirs {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readForm reads the form starting at the line of the file.
+func readForm(path string, line int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	buf := &formBuffer{}
+	var sb strings.Builder
+	for n := 1; scanner.Scan(); n++ {
+		if n < line {
+			continue
+		}
+		s := scanner.Text() + "\n"
+		sb.WriteString(s)
+		forms, err := buf.feed(s)
+		if err != nil {
+			return "", err
+		}
+		if len(forms) > 0 {
+			return sb.String(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no form found at %s:%d", path, line)
+}
+
+// sourceByEval fetches the source of the var from the server, which can
+// read it from jars on the classpath.
+func (r *Repl) sourceByEval(sym string) (string, error) {
+	return r.evalString(fmt.Sprintf("(do (require 'clojure.repl) (clojure.repl/source-fn '%s))", sym))
+}
+
+// Source shows the source code of the var named by the symbol with line
+// numbers. The source is read from the local file if available, and
+// fetched from the server otherwise.
+func (r *Repl) Source(sym string) error {
+	info, err := r.lookupSymbol(sym)
+	if err != nil {
+		return err
+	}
+	if info == nil || info.Name == "" || info.Special {
+		r.commandError("Source not found for %s", sym)
+		return fmt.Errorf("source not found for %s", sym)
+	}
+	var src string
+	if path := localSourcePath(info); path != "" && info.Line > 0 {
+		src, err = readForm(path, info.Line)
+		if err != nil {
+			r.commandError("Failed to read source from %s (%s)", path, err)
+			return err
+		}
+	} else if src, err = r.sourceByEval(info.qualifiedName()); err != nil {
+		return err
+	}
+	if src == "" {
+		r.commandError("Source not found for %s", sym)
+		return fmt.Errorf("source not found for %s", sym)
+	}
+	out := r.reportWriter()
+	if loc := info.location(); loc != "" {
+		r.printer.With(color.Faint).Fprintln(out, loc)
+	}
+	r.printHighlighted(out, src, info.Line)
+	return nil
+}
+
+// editorCommand returns the command to open the file at the line in the
+// editor, in the "+LINE FILE" form most editors understand.
+func editorCommand(editor, path string, line int) *exec.Cmd {
+	args := strings.Fields(editor)
+	if line > 0 {
+		args = append(args, fmt.Sprintf("+%d", line))
+	}
+	args = append(args, path)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// Edit opens the local file where the var named by the symbol is defined
+// in $VISUAL or $EDITOR, at the line of the definition.
+func (r *Repl) Edit(sym string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if strings.TrimSpace(editor) == "" {
+		r.commandError("Set $EDITOR to open the source in an editor")
+		return fmt.Errorf("no editor specified")
+	}
+	info, err := r.lookupSymbol(sym)
+	if err != nil {
+		return err
+	}
+	if info == nil || info.Name == "" || info.Special {
+		r.commandError("Source not found for %s", sym)
+		return fmt.Errorf("source not found for %s", sym)
+	}
+	path := localSourcePath(info)
+	if path == "" {
+		r.commandError("The source of %s is not available in a local file: %s", sym, info.location())
+		return fmt.Errorf("source not available locally for %s", sym)
+	}
+	if err := editorCommand(editor, path, info.Line).Run(); err != nil {
+		r.commandError("Failed to run the editor (%s)", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const coreSource = `(ns myapp.core)
+
+(defn greet
+  "Greets."
+  [name]
+  (str "Hello, " name))
+
+(def x 1)
+`
+
+func TestLocalSourcePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "src", "myapp", "core.clj")
+	testutil.WriteFile(t, path, coreSource)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	assert.Equal(t, path, localSourcePath(&symbolInfo{File: "file:" + path}))
+	assert.Equal(t, path, localSourcePath(&symbolInfo{File: path}))
+	assert.Equal(t, filepath.Join("src", "myapp", "core.clj"), localSourcePath(&symbolInfo{File: "myapp/core.clj"}))
+	assert.Equal(t, filepath.Join("src", "myapp", "core.clj"), localSourcePath(&symbolInfo{File: "/nonexistent/src/myapp/core.clj", Resource: "myapp/core.clj"}))
+	assert.Equal(t, "", localSourcePath(&symbolInfo{File: "jar:file:/m2/clojure.jar!/clojure/core.clj", Resource: "clojure/core.clj"}))
+	assert.Equal(t, "", localSourcePath(&symbolInfo{}))
+}
+
+func TestReadForm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "core.clj")
+	testutil.WriteFile(t, path, coreSource)
+	src, err := readForm(path, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "(defn greet\n  \"Greets.\"\n  [name]\n  (str \"Hello, \" name))\n", src)
+
+	_, err = readForm(path, 100)
+	assert.NotNil(t, err)
+}
+
+func TestSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "core.clj")
+	testutil.WriteFile(t, path, coreSource)
+	repl, c := setupOpRepl(map[string][]map[string]interface{}{
+		"info": {{"ns": "myapp.core", "name": "greet", "file": path, "resource": "myapp/core.clj", "line": 3}},
+	})
+	assert.Nil(t, repl.Source("greet"))
+	expected := "myapp/core.clj:3\n" +
+		"3  (defn greet\n" +
+		"4    \"Greets.\"\n" +
+		"5    [name]\n" +
+		"6    (str \"Hello, \" name))\n"
+	assert.Equal(t, expected, c.outs.String())
+
+	c.resps["info"] = []map[string]interface{}{{"ns": "clojure.core", "name": "inc", "file": "jar:file:/m2/clojure.jar!/clojure/core.clj", "line": 922}}
+	c.step = step{"(do (require 'clojure.repl) (clojure.repl/source-fn 'clojure.core/inc))", func(ch chan<- client.EvalResult) {
+		ch <- `"(defn inc\n  [x] (. clojure.lang.Numbers (inc x)))"`
+	}}
+	c.outs.Reset()
+	assert.Nil(t, repl.Source("inc"))
+	expected = "jar:file:/m2/clojure.jar!/clojure/core.clj:922\n" +
+		"922  (defn inc\n" +
+		"923    [x] (. clojure.lang.Numbers (inc x)))\n"
+	assert.Equal(t, expected, c.outs.String())
+
+	c.resps["info"] = []map[string]interface{}{{"ns": "clojure.core", "name": "if", "special-form": "true"}}
+	c.outs.Reset()
+	assert.NotNil(t, repl.Source("if"))
+	assert.Equal(t, "Source not found for if\n", c.outs.String())
+}
+
+func TestEditorCommand(t *testing.T) {
+	cmd := editorCommand("emacsclient -nw", "src/myapp/core.clj", 3)
+	assert.Equal(t, []string{"emacsclient", "-nw", "+3", "src/myapp/core.clj"}, cmd.Args)
+
+	cmd = editorCommand("vi", "core.clj", 0)
+	assert.Equal(t, []string{"vi", "core.clj"}, cmd.Args)
+}
+
+// countingReader counts the reads in progress on the input.
+type countingReader struct {
+	*mockReader
+	reading int32
+}
+
+func (r *countingReader) Read(bytes []byte) (int, error) {
+	atomic.AddInt32(&r.reading, 1)
+	defer atomic.AddInt32(&r.reading, -1)
+	return r.mockReader.Read(bytes)
+}
+
+func TestEditReadsNoInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake editor is a shell script")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "core.clj")
+	testutil.WriteFile(t, path, coreSource)
+	started := filepath.Join(dir, "started")
+	finished := filepath.Join(dir, "finished")
+	editor := filepath.Join(dir, "editor")
+	testutil.WriteFile(t, editor, fmt.Sprintf("#!/bin/sh\ntouch '%s'\nwhile [ ! -f '%s' ]; do sleep 0.01; done\n", started, finished))
+	if err := os.Chmod(editor, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", editor)
+
+	// the var is looked up by evaluation, which used to leave a read of
+	// the input pending for the stdin of the evaluation
+	info := fmt.Sprintf(`{:ns "myapp.core" :name "greet" :file %q :line 3}`, path)
+	c := newMockClient(step{fmt.Sprintf(lookupCode, "greet"), func(ch chan<- client.EvalResult) {
+		ch <- strconv.Quote(info)
+	}})
+	in := make(chan string)
+	reader := &countingReader{mockReader: newMockReader(in)}
+	repl := setupRepl(reader.mockReader, c)
+	repl.in = newReader(reader)
+	done := make(chan struct{})
+	go func() {
+		repl.Start()
+		close(done)
+	}()
+	in <- ",edit greet\n"
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the editor didn't start")
+		}
+	}
+	// give a stray read the time to start
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reader.reading))
+	testutil.WriteFile(t, finished, "")
+	in <- ":repl/quit\n"
+	<-done
+	assert.Equal(t, "", c.errs.String())
+}
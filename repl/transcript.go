@@ -0,0 +1,170 @@
+package repl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/athos/trenchman/client"
+)
+
+// maxTranscriptLine is the maximum size of an event in transcripts.
+const maxTranscriptLine = 64 * 1024 * 1024
+
+// TranscriptEntry is an input recorded in a transcript along with the last
+// value or exception resulting from it, if any.
+type TranscriptEntry struct {
+	Input  *Event
+	Result *Event
+}
+
+// record writes the event to the transcript with the current time, if
+// recording.
+func (r *Repl) record(event *Event) {
+	if r.recorder == nil {
+		return
+	}
+	now := time.Now()
+	e := *event
+	e.Time = &now
+	r.recorder.write(&e)
+}
+
+func (r *Repl) recordInput(code string) {
+	r.record(&Event{Type: EventInput, NS: r.currentClient().CurrentNS(), Text: code})
+}
+
+// loadInput returns the code recorded as the input that loads the file, so
+// that replaying it loads the file again. The content of stdin is recorded
+// as is, since stdin can't be read again.
+func loadInput(filename, content string) string {
+	if filename == "-" {
+		return content
+	}
+	if path, err := filepath.Abs(filename); err == nil {
+		filename = path
+	}
+	return fmt.Sprintf("(load-file %s)", client.QuoteString(filename))
+}
+
+func (r *Repl) recordError(err error) {
+	if rtErr, ok := err.(*client.RuntimeError); ok {
+		r.record(exceptionEvent(rtErr))
+	}
+}
+
+// ReadTranscript reads the transcript recorded with Opts.Record, and
+// returns the inputs along with their results.
+func ReadTranscript(reader io.Reader) ([]*TranscriptEntry, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxTranscriptLine)
+	entries := []*TranscriptEntry{}
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		event := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, fmt.Errorf("malformed transcript at line %d (%w)", n, err)
+		}
+		switch event.Type {
+		case EventInput:
+			entries = append(entries, &TranscriptEntry{Input: event})
+		case EventValue, EventException:
+			if len(entries) > 0 {
+				entries[len(entries)-1].Result = event
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Replay evaluates the input of the entry again in the namespace where it
+// was recorded, and returns the result as an event. The namespace is
+// required first if it's not loaded yet, and the failure to load it is
+// returned as the result. The error is returned only if the evaluation
+// couldn't complete (e.g. disconnection).
+func (r *Repl) Replay(entry *TranscriptEntry) (*Event, error) {
+	if ns := entry.Input.NS; ns != "" && ns != r.currentClient().CurrentNS() {
+		if err := r.inNS(ns); err != nil {
+			if rtErr, ok := err.(*client.RuntimeError); ok {
+				return exceptionEvent(rtErr), nil
+			}
+			return nil, err
+		}
+	}
+	value, err := r.EvalForValue(entry.Input.Text)
+	if err != nil {
+		if rtErr, ok := err.(*client.RuntimeError); ok {
+			return exceptionEvent(rtErr), nil
+		}
+		return nil, err
+	}
+	return valueEvent(r.currentClient().CurrentNS(), value), nil
+}
+
+// exStrHeaders are the beginnings of the first lines of the messages built
+// by clojure.main/ex-str, which precede the messages of the causes.
+var exStrHeaders = []string{
+	"Syntax error ",
+	"Unexpected error ",
+	"Execution error ",
+	"Error reading eval result ",
+	"Error printing return value ",
+}
+
+// causeMessage returns the message of the cause of the exception. The
+// header line built by clojure.main/ex-str is dropped, since it contains
+// the names of the classes generated for each evaluation (e.g.
+// user/eval1234).
+func causeMessage(message string) string {
+	if header, cause, ok := strings.Cut(message, "\n"); ok {
+		for _, prefix := range exStrHeaders {
+			if strings.HasPrefix(header, prefix) {
+				return strings.TrimSpace(cause)
+			}
+		}
+	}
+	return strings.TrimSpace(message)
+}
+
+// SameResult reports whether the results are the same. Exceptions are
+// compared by the messages of their causes, and by their classes and
+// phases if both are known.
+func SameResult(expected, actual *Event) bool {
+	if expected == nil || actual == nil {
+		return expected == actual
+	}
+	if expected.Type != actual.Type {
+		return false
+	}
+	if expected.Type == EventException {
+		return causeMessage(expected.Message) == causeMessage(actual.Message) &&
+			(expected.Class == "" || actual.Class == "" || expected.Class == actual.Class) &&
+			(expected.Phase == "" || actual.Phase == "" || expected.Phase == actual.Phase)
+	}
+	return expected.Value != nil && actual.Value != nil && *expected.Value == *actual.Value
+}
+
+// ResultString describes the result for reporting differences.
+func ResultString(e *Event) string {
+	switch {
+	case e == nil:
+		return "(no result)"
+	case e.Type == EventException && e.Class != "":
+		return fmt.Sprintf("exception %s: %s", e.Class, e.Message)
+	case e.Type == EventException:
+		return "exception: " + e.Message
+	case e.Value != nil:
+		return *e.Value
+	default:
+		return "(no result)"
+	}
+}
@@ -0,0 +1,189 @@
+package repl
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReadTranscript(t *testing.T) {
+	c := newMockClient(step{`(do (println "hi") 42)`, func(ch chan<- client.EvalResult) {
+		ch <- "42"
+	}})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	transcript := &bytes.Buffer{}
+	repl.recorder = newEventWriter(transcript)
+
+	repl.evalAndRecord(`(do (println "hi") 42)`)
+	repl.Out("hi\n")
+	c.step = step{"(/ 1 0)", func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeErrorWithDetails("Divide by zero", &client.ErrorDetails{Class: "java.lang.ArithmeticException"})
+	}}
+	assert.NotNil(t, repl.Eval("(/ 1 0)"))
+	c.step = step{"(inc 1)", func(ch chan<- client.EvalResult) {
+		ch <- "2"
+	}}
+	repl.EvalForValue("(inc 1)")
+
+	lines := strings.Split(strings.TrimSpace(transcript.String()), "\n")
+	assert.Equal(t, 5, len(lines))
+	for _, line := range lines {
+		assert.Contains(t, line, `"time":`)
+	}
+
+	entries, err := ReadTranscript(transcript)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, `(do (println "hi") 42)`, entries[0].Input.Text)
+	assert.Equal(t, "user", entries[0].Input.NS)
+	assert.Equal(t, "42", *entries[0].Result.Value)
+	assert.Equal(t, "(/ 1 0)", entries[1].Input.Text)
+	assert.Equal(t, EventException, entries[1].Result.Type)
+	assert.Equal(t, "java.lang.ArithmeticException", entries[1].Result.Class)
+
+	_, err = ReadTranscript(strings.NewReader("{\"type\":\"input\"}\nnot json\n"))
+	assert.EqualError(t, err, "malformed transcript at line 2 (invalid character 'o' in literal null (expecting 'u'))")
+}
+
+func TestRecordLoads(t *testing.T) {
+	dir := t.TempDir()
+	init := filepath.Join(dir, "init.clj")
+	core := filepath.Join(dir, "core.clj")
+	broken := filepath.Join(dir, "broken.clj")
+	testutil.WriteFile(t, init, "(ns init)")
+	testutil.WriteFile(t, core, "(ns myapp.core)\n(defn f [] 42)")
+	testutil.WriteFile(t, broken, "(ns myapp.broken)\n(f)")
+	c := newMockClient(step{"(+ 1 2)", func(ch chan<- client.EvalResult) {
+		ch <- "3"
+	}})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	transcript := &bytes.Buffer{}
+	repl.recorder = newEventWriter(transcript)
+
+	// -i, -e, -f and -f with an error, in this order
+	c.load = func(ch chan<- client.EvalResult) {
+		ch <- "nil"
+	}
+	assert.Nil(t, repl.LoadInit(init))
+	assert.Nil(t, repl.Eval("(+ 1 2)"))
+	c.load = func(ch chan<- client.EvalResult) {
+		ch <- "#'myapp.core/f"
+	}
+	assert.Nil(t, repl.Load(core))
+	c.load = func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeErrorWithDetails("Unable to resolve symbol: f in this context", &client.ErrorDetails{
+			Class: "clojure.lang.Compiler$CompilerException",
+			Phase: "compile-syntax-check",
+		})
+	}
+	assert.NotNil(t, repl.Load(broken))
+
+	entries, err := ReadTranscript(transcript)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "(+ 1 2)", entries[0].Input.Text)
+	assert.Equal(t, "3", *entries[0].Result.Value)
+	assert.Equal(t, fmt.Sprintf("(load-file %s)", client.QuoteString(core)), entries[1].Input.Text)
+	assert.Equal(t, "#'myapp.core/f", *entries[1].Result.Value)
+	assert.Equal(t, fmt.Sprintf("(load-file %s)", client.QuoteString(broken)), entries[2].Input.Text)
+	assert.Equal(t, EventException, entries[2].Result.Type)
+	assert.Equal(t, "compile-syntax-check", entries[2].Result.Phase)
+
+	// replaying the load loads the file again
+	c.step = step{entries[1].Input.Text, func(ch chan<- client.EvalResult) {
+		ch <- "#'myapp.core/f"
+	}}
+	actual, err := repl.Replay(entries[1])
+	assert.Nil(t, err)
+	assert.True(t, SameResult(entries[1].Result, actual))
+}
+
+func TestReplay(t *testing.T) {
+	c := newMockClient(step{"(inc 1)", func(ch chan<- client.EvalResult) {
+		ch <- "3"
+	}})
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	entries, err := ReadTranscript(strings.NewReader(
+		`{"type":"input","ns":"user","text":"(inc 1)"}` + "\n" +
+			`{"type":"value","ns":"user","value":"2"}` + "\n"))
+	assert.Nil(t, err)
+	actual, err := repl.Replay(entries[0])
+	assert.Nil(t, err)
+	assert.False(t, SameResult(entries[0].Result, actual))
+	assert.Equal(t, "2", ResultString(entries[0].Result))
+	assert.Equal(t, "3", ResultString(actual))
+
+	c.step = step{"(/ 1 0)", func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeError("Divide by zero")
+	}}
+	actual, err = repl.Replay(&TranscriptEntry{Input: &Event{Type: EventInput, Text: "(/ 1 0)"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "exception: Divide by zero", ResultString(actual))
+}
+
+func TestReplayRequiresNamespace(t *testing.T) {
+	c := newMockClient(step{})
+	inNS := "(do (when-not (find-ns 'foo.core) (require 'foo.core)) (in-ns 'foo.core))"
+	c.step = step{inNS, func(ch chan<- client.EvalResult) {
+		ch <- "#object[clojure.lang.Namespace 0x1 \"foo.core\"]"
+		c.step = step{"(f)", func(ch chan<- client.EvalResult) {
+			ch <- "42"
+		}}
+	}}
+	repl := setupRepl(newMockReader(make(chan string)), c)
+	actual, err := repl.Replay(&TranscriptEntry{Input: &Event{Type: EventInput, NS: "foo.core", Text: "(f)"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "42", ResultString(actual))
+
+	c.step = step{inNS, func(ch chan<- client.EvalResult) {
+		ch <- client.NewRuntimeError("Could not locate foo/core__init.class")
+	}}
+	actual, err = repl.Replay(&TranscriptEntry{Input: &Event{Type: EventInput, NS: "foo.core", Text: "(f)"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "exception: Could not locate foo/core__init.class", ResultString(actual))
+}
+
+func TestSameResult(t *testing.T) {
+	v1, v2 := "1", "2"
+	tests := []struct {
+		expected, actual *Event
+		same             bool
+	}{
+		{nil, nil, true},
+		{&Event{Type: EventValue, Value: &v1}, nil, false},
+		{&Event{Type: EventValue, Value: &v1}, &Event{Type: EventValue, NS: "foo", Value: &v1}, true},
+		{&Event{Type: EventValue, Value: &v1}, &Event{Type: EventValue, Value: &v2}, false},
+		{&Event{Type: EventException, Message: "Boom"}, &Event{Type: EventException, Message: "Boom", Class: "Ex"}, true},
+		{&Event{Type: EventException, Message: "Boom", Class: "Ex1"}, &Event{Type: EventException, Message: "Boom", Class: "Ex2"}, false},
+		{&Event{Type: EventException, Message: "1"}, &Event{Type: EventValue, Value: &v1}, false},
+		{
+			&Event{Type: EventException, Message: "Execution error (ArithmeticException) at user/eval2056 (REPL:1).\nDivide by zero", Class: "java.lang.ArithmeticException", Phase: "execution"},
+			&Event{Type: EventException, Message: "Execution error (ArithmeticException) at user/eval2103 (REPL:1).\nDivide by zero", Class: "java.lang.ArithmeticException", Phase: "execution"},
+			true,
+		},
+		{
+			&Event{Type: EventException, Message: "Execution error (ArithmeticException) at user/eval2056 (REPL:1).\nDivide by zero"},
+			&Event{Type: EventException, Message: "Divide by zero"},
+			true,
+		},
+		{
+			&Event{Type: EventException, Message: "Boom", Phase: "execution"},
+			&Event{Type: EventException, Message: "Boom", Phase: "compile-syntax-check"},
+			false,
+		},
+		{
+			&Event{Type: EventException, Message: "Execution error at user/eval1 (REPL:1).\nBoom"},
+			&Event{Type: EventException, Message: "Execution error at user/eval2 (REPL:1).\nBang"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.same, SameResult(tt.expected, tt.actual))
+	}
+}
@@ -0,0 +1,131 @@
+package testrunner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+)
+
+func (r *Runner) runWithOp(sel Selection) ([]*TestVar, error) {
+	req := map[string]interface{}{
+		"op": "test",
+		"ns": sel.NS,
+	}
+	if len(sel.Vars) > 0 {
+		tests := make([]bencode.Datum, len(sel.Vars))
+		for i, v := range sel.Vars {
+			tests[i] = v
+		}
+		req["tests"] = tests
+	}
+	ch, ok := r.evaluator.SendOp(req)
+	if !ok {
+		return nil, errors.New("test op is not available")
+	}
+	// the responses must be received until the op is done, even after an
+	// error, since the client blocks until they are received
+	defer func() {
+		for range ch {
+		}
+	}()
+	ret := []*TestVar{}
+	for resp := range ch {
+		if results, ok := resp["results"]; ok {
+			tests, err := parseOpResults(results)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, tests...)
+		}
+		if client.HasStatus(resp, "namespace-not-found") {
+			return nil, fmt.Errorf("namespace not found: %s", sel.NS)
+		}
+	}
+	return ret, nil
+}
+
+// parseOpResults converts the results of the test op, which are organized
+// as {ns {var [result ...]}}, into test vars sorted by name.
+func parseOpResults(results bencode.Datum) ([]*TestVar, error) {
+	errMalformed := fmt.Errorf("malformed test results: %v", results)
+	nss, ok := results.(map[string]bencode.Datum)
+	if !ok {
+		return nil, errMalformed
+	}
+	ret := []*TestVar{}
+	for _, ns := range sortedKeys(nss) {
+		vars, ok := nss[ns].(map[string]bencode.Datum)
+		if !ok {
+			return nil, errMalformed
+		}
+		for _, v := range sortedKeys(vars) {
+			entries, ok := vars[v].([]bencode.Datum)
+			if !ok {
+				return nil, errMalformed
+			}
+			test := &TestVar{NS: ns, Var: v}
+			for _, entry := range entries {
+				m, ok := entry.(map[string]bencode.Datum)
+				if !ok {
+					return nil, errMalformed
+				}
+				test.Results = append(test.Results, parseOpResult(m))
+			}
+			ret = append(ret, test)
+		}
+	}
+	return ret, nil
+}
+
+func sortedKeys(m map[string]bencode.Datum) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseOpResult(m map[string]bencode.Datum) *Result {
+	str := func(key string) string {
+		s, _ := m[key].(string)
+		// values are pretty-printed with a trailing newline
+		return strings.TrimSuffix(s, "\n")
+	}
+	res := &Result{
+		Type:     str("type"),
+		Context:  str("context"),
+		Message:  str("message"),
+		Expected: str("expected"),
+		Actual:   str("actual"),
+		File:     str("file"),
+	}
+	if line, ok := m["line"].(int); ok {
+		res.Line = line
+	}
+	// diffs are [[actual [removed added]] ...]
+	diffs, _ := m["diffs"].([]bencode.Datum)
+	for _, d := range diffs {
+		pair, ok := d.([]bencode.Datum)
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		changes, ok := pair[1].([]bencode.Datum)
+		if !ok || len(changes) != 2 {
+			continue
+		}
+		diff := Diff{}
+		diff.Actual, _ = pair[0].(string)
+		diff.Removed, _ = changes[0].(string)
+		diff.Added, _ = changes[1].(string)
+		diff.Actual = strings.TrimSuffix(diff.Actual, "\n")
+		diff.Removed = strings.TrimSuffix(diff.Removed, "\n")
+		diff.Added = strings.TrimSuffix(diff.Added, "\n")
+		res.Diffs = append(res.Diffs, diff)
+	}
+	return res
+}
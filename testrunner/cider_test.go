@@ -0,0 +1,73 @@
+package testrunner
+
+import (
+	"testing"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOpResults(t *testing.T) {
+	results := map[string]bencode.Datum{
+		"foo-test": map[string]bencode.Datum{
+			"b-test": []bencode.Datum{
+				map[string]bencode.Datum{
+					"type":     "error",
+					"expected": "nil\n",
+					"actual":   "java.lang.ArithmeticException: Divide by zero\n",
+					"file":     "core_test.clj",
+					"line":     8,
+				},
+			},
+			"a-test": []bencode.Datum{
+				map[string]bencode.Datum{"type": "pass"},
+				map[string]bencode.Datum{
+					"type":     "fail",
+					"context":  "arithmetic",
+					"message":  "",
+					"expected": "3\n",
+					"actual":   "2\n",
+					"diffs": []bencode.Datum{
+						[]bencode.Datum{"2\n", []bencode.Datum{"3\n", "2\n"}},
+					},
+					"file": "core_test.clj",
+					"line": 5,
+				},
+			},
+		},
+	}
+	tests, err := parseOpResults(results)
+	assert.Nil(t, err)
+	assert.Equal(t, []*TestVar{
+		{
+			NS:  "foo-test",
+			Var: "a-test",
+			Results: []*Result{
+				{Type: RESULT_PASS},
+				{
+					Type:     RESULT_FAIL,
+					Context:  "arithmetic",
+					Expected: "3",
+					Actual:   "2",
+					Diffs:    []Diff{{Actual: "2", Removed: "3", Added: "2"}},
+					File:     "core_test.clj",
+					Line:     5,
+				},
+			},
+		},
+		{
+			NS:  "foo-test",
+			Var: "b-test",
+			Results: []*Result{{
+				Type:     RESULT_ERROR,
+				Expected: "nil",
+				Actual:   "java.lang.ArithmeticException: Divide by zero",
+				File:     "core_test.clj",
+				Line:     8,
+			}},
+		},
+	}, tests)
+
+	_, err = parseOpResults([]bencode.Datum{})
+	assert.NotNil(t, err)
+}
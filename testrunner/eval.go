@@ -0,0 +1,127 @@
+package testrunner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/athos/trenchman/client"
+	"olympos.io/encoding/edn"
+)
+
+// runTestsCode runs the tests with clojure.test/report rebound to collect
+// the events, and returns them as an EDN string. The diffs of failed
+// (= expected actual) assertions are computed by clojure.data/diff, as
+// cider-nrepl does.
+const runTestsCode = `(let [events (atom [])` +
+	` value-str (fn [x] (if (instance? Throwable x)` +
+	` (str (.getName (class x)) ": " (.getMessage ^Throwable x))` +
+	` (pr-str x)))]` +
+	` (require 'clojure.data)` +
+	` (binding [clojure.test/report` +
+	` (fn [m]` +
+	` (let [v (first clojure.test/*testing-vars*)` +
+	` base {:type (name (:type m))` +
+	` :ns (if v (str (ns-name (:ns (meta v)))) %s)` +
+	` :var (if v (str (:name (meta v))) "")}]` +
+	` (case (:type m)` +
+	` (:begin-test-var :pass) (swap! events conj base)` +
+	` (:fail :error)` +
+	` (let [{:keys [expected actual]} m` +
+	` [op cmp] (when (seq? actual) actual)` +
+	` [eq e & as] (when (seq? cmp) cmp)]` +
+	` (swap! events conj` +
+	` (assoc base` +
+	` :context (clojure.test/testing-contexts-str)` +
+	` :message (str (:message m))` +
+	` :expected (value-str expected)` +
+	` :actual (value-str actual)` +
+	` :diffs (when (and (= :fail (:type m)) (= 'not op) (= '= eq))` +
+	` (vec (for [a as] (let [[removed added] (clojure.data/diff e a)]` +
+	` [(pr-str a) (pr-str removed) (pr-str added)]))))` +
+	` :file (str (:file m))` +
+	` :line (or (:line m) 0))))` +
+	` nil)))]` +
+	` %s)` +
+	` (binding [` + client.PrintBindings + `]` +
+	` (pr-str @events)))`
+
+type event struct {
+	Type     string     `edn:"type"`
+	NS       string     `edn:"ns"`
+	Var      string     `edn:"var"`
+	Context  string     `edn:"context"`
+	Message  string     `edn:"message"`
+	Expected string     `edn:"expected"`
+	Actual   string     `edn:"actual"`
+	Diffs    [][]string `edn:"diffs"`
+	File     string     `edn:"file"`
+	Line     int        `edn:"line"`
+}
+
+func quoteSymbol(s string) string {
+	return "'" + s
+}
+
+func runTestsInvocation(sel Selection) string {
+	var run string
+	if len(sel.Vars) == 0 {
+		run = fmt.Sprintf("(clojure.test/test-ns %s)", quoteSymbol(sel.NS))
+	} else {
+		run = fmt.Sprintf(
+			"(clojure.test/test-vars (keep (partial ns-resolve %s) %s))",
+			quoteSymbol(sel.NS),
+			quoteSymbol("["+strings.Join(sel.Vars, " ")+"]"),
+		)
+	}
+	return fmt.Sprintf(runTestsCode, fmt.Sprintf("%q", sel.NS), run)
+}
+
+func (r *Runner) runWithEval(sel Selection) ([]*TestVar, error) {
+	value, err := r.evaluator.EvalForValue(runTestsInvocation(sel))
+	if err != nil {
+		return nil, err
+	}
+	return parseEvents(value)
+}
+
+// parseEvents groups the events printed as an EDN string by test var.
+func parseEvents(value string) ([]*TestVar, error) {
+	var s string
+	if err := edn.UnmarshalString(value, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse test results (%w)", err)
+	}
+	var events []event
+	if err := edn.UnmarshalString(s, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse test results (%w)", err)
+	}
+	ret := []*TestVar{}
+	tests := map[[2]string]*TestVar{}
+	for _, e := range events {
+		key := [2]string{e.NS, e.Var}
+		test, ok := tests[key]
+		if !ok {
+			test = &TestVar{NS: e.NS, Var: e.Var}
+			tests[key] = test
+			ret = append(ret, test)
+		}
+		if e.Type == "begin-test-var" {
+			continue
+		}
+		res := &Result{
+			Type:     e.Type,
+			Context:  e.Context,
+			Message:  e.Message,
+			Expected: e.Expected,
+			Actual:   e.Actual,
+			File:     e.File,
+			Line:     e.Line,
+		}
+		for _, d := range e.Diffs {
+			if len(d) == 3 {
+				res.Diffs = append(res.Diffs, Diff{Actual: d[0], Removed: d[1], Added: d[2]})
+			}
+		}
+		test.Results = append(test.Results, res)
+	}
+	return ret, nil
+}
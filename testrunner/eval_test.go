@@ -0,0 +1,74 @@
+package testrunner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTestsInvocation(t *testing.T) {
+	code := runTestsInvocation(Selection{NS: "foo.core-test"})
+	assert.True(t, strings.HasSuffix(code[:strings.Index(code, " (binding [*print-length*")], " (clojure.test/test-ns 'foo.core-test))"))
+	assert.Contains(t, code, `:ns (if v (str (ns-name (:ns (meta v)))) "foo.core-test")`)
+
+	code = runTestsInvocation(Selection{NS: "foo.core-test", Vars: []string{"a-test", "b-test"}})
+	assert.Contains(t, code, "(clojure.test/test-vars (keep (partial ns-resolve 'foo.core-test) '[a-test b-test]))")
+}
+
+func TestParseEvents(t *testing.T) {
+	value := `"[` +
+		`{:type \"begin-test-var\", :ns \"foo-test\", :var \"a-test\"}` +
+		` {:type \"pass\", :ns \"foo-test\", :var \"a-test\"}` +
+		` {:type \"fail\", :ns \"foo-test\", :var \"a-test\", :context \"arithmetic\", :message \"\",` +
+		` :expected \"(= 3 (+ 1 1))\", :actual \"(not (= 3 2))\", :diffs [[\"2\" \"3\" \"2\"]], :file \"core_test.clj\", :line 5}` +
+		` {:type \"begin-test-var\", :ns \"foo-test\", :var \"b-test\"}` +
+		` {:type \"error\", :ns \"foo-test\", :var \"b-test\", :context \"\", :message \"\",` +
+		` :expected \"nil\", :actual \"java.lang.ArithmeticException: Divide by zero\", :diffs nil, :file \"core_test.clj\", :line 8}` +
+		` {:type \"error\", :ns \"foo-test\", :var \"\", :context \"\", :message \"fixture\",` +
+		` :expected \"nil\", :actual \"java.lang.Exception: boom\", :diffs nil, :file \"\", :line 0}` +
+		`]"`
+	tests, err := parseEvents(value)
+	assert.Nil(t, err)
+	assert.Equal(t, []*TestVar{
+		{
+			NS:  "foo-test",
+			Var: "a-test",
+			Results: []*Result{
+				{Type: RESULT_PASS},
+				{
+					Type:     RESULT_FAIL,
+					Context:  "arithmetic",
+					Expected: "(= 3 (+ 1 1))",
+					Actual:   "(not (= 3 2))",
+					Diffs:    []Diff{{Actual: "2", Removed: "3", Added: "2"}},
+					File:     "core_test.clj",
+					Line:     5,
+				},
+			},
+		},
+		{
+			NS:  "foo-test",
+			Var: "b-test",
+			Results: []*Result{{
+				Type:     RESULT_ERROR,
+				Expected: "nil",
+				Actual:   "java.lang.ArithmeticException: Divide by zero",
+				File:     "core_test.clj",
+				Line:     8,
+			}},
+		},
+		{
+			NS: "foo-test",
+			Results: []*Result{{
+				Type:     RESULT_ERROR,
+				Message:  "fixture",
+				Expected: "nil",
+				Actual:   "java.lang.Exception: boom",
+			}},
+		},
+	}, tests)
+
+	_, err = parseEvents("{:foo")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,80 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type (
+	junitTestSuites struct {
+		XMLName xml.Name         `xml:"testsuites"`
+		Suites  []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Errors   int             `xml:"errors,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string         `xml:"name,attr"`
+		ClassName string         `xml:"classname,attr"`
+		Failures  []junitFailure `xml:"failure"`
+		Errors    []junitFailure `xml:"error"`
+	}
+
+	junitFailure struct {
+		Message string `xml:"message,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// WriteJUnit writes the results in the JUnit XML format, with a test suite
+// for each namespace and a test case for each test var.
+func WriteJUnit(w io.Writer, tests []*TestVar) error {
+	suites := junitTestSuites{Suites: []junitTestSuite{}}
+	indices := map[string]int{}
+	for _, t := range tests {
+		i, ok := indices[t.NS]
+		if !ok {
+			i = len(suites.Suites)
+			indices[t.NS] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: t.NS})
+		}
+		suite := &suites.Suites[i]
+		name := t.Var
+		if name == "" {
+			// errors outside of test vars
+			name = t.NS
+		}
+		tc := junitTestCase{Name: name, ClassName: t.NS}
+		for _, res := range t.Failures() {
+			failure := junitFailure{Message: res.Message, Text: res.Description()}
+			if failure.Message == "" {
+				failure.Message = res.Context
+			}
+			if res.Type == RESULT_ERROR {
+				tc.Errors = append(tc.Errors, failure)
+				suite.Errors++
+			} else {
+				tc.Failures = append(tc.Failures, failure)
+				suite.Failures++
+			}
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,49 @@
+package testrunner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	tests := []*TestVar{
+		{NS: "foo-test", Var: "a-test", Results: []*Result{{Type: RESULT_PASS}}},
+		{
+			NS:  "foo-test",
+			Var: "b-test",
+			Results: []*Result{{
+				Type:     RESULT_FAIL,
+				Context:  "arithmetic",
+				Expected: "(= 3 (+ 1 1))",
+				Actual:   "(not (= 3 2))",
+			}},
+		},
+		{
+			NS: "bar-test",
+			Results: []*Result{{
+				Type:    RESULT_ERROR,
+				Message: "failed to load namespace",
+				Actual:  "<boom>",
+			}},
+		},
+	}
+	sb := new(strings.Builder)
+	assert.Nil(t, WriteJUnit(sb, tests))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="foo-test" tests="2" failures="1" errors="0">
+    <testcase name="a-test" classname="foo-test"></testcase>
+    <testcase name="b-test" classname="foo-test">
+      <failure message="arithmetic">arithmetic&#xA;expected: (= 3 (+ 1 1))&#xA;  actual: (not (= 3 2))&#xA;</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="bar-test" tests="1" failures="0" errors="1">
+    <testcase name="bar-test" classname="bar-test">
+      <error message="failed to load namespace">failed to load namespace&#xA;  actual: &lt;boom&gt;&#xA;</error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`, sb.String())
+}
@@ -0,0 +1,289 @@
+// Package testrunner runs clojure.test tests on the server, either via the
+// test op provided by cider-nrepl or by evaluating code, and collects the
+// results.
+package testrunner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/watcher"
+)
+
+const (
+	RESULT_PASS  = "pass"
+	RESULT_FAIL  = "fail"
+	RESULT_ERROR = "error"
+)
+
+type (
+	// Evaluator evaluates code on the server, which is usually a *repl.Repl.
+	Evaluator interface {
+		SupportsOp(op string) bool
+		EvalForValue(code string) (string, error)
+		SendOp(req map[string]interface{}) (<-chan map[string]interface{}, bool)
+	}
+
+	// Selection is the tests to run in a namespace. All the tests in the
+	// namespace are run if Vars is empty.
+	Selection struct {
+		NS   string
+		Vars []string
+	}
+
+	// TestVar is the results of the assertions made in a test var. Var is
+	// empty for the errors that occurred outside of test vars, e.g. in
+	// fixtures or while loading the namespace.
+	TestVar struct {
+		NS      string
+		Var     string
+		Results []*Result
+	}
+
+	Result struct {
+		Type     string
+		Context  string
+		Message  string
+		Expected string
+		Actual   string
+		Diffs    []Diff
+		File     string
+		Line     int
+	}
+
+	// Diff is the difference between the expected value and an actual one
+	// of a failed (= expected actual) assertion.
+	Diff struct {
+		Actual  string
+		Removed string
+		Added   string
+	}
+
+	Summary struct {
+		NS    int
+		Vars  int
+		Tests int
+		Pass  int
+		Fail  int
+		Error int
+	}
+
+	Runner struct {
+		evaluator Evaluator
+		useOp     bool
+	}
+)
+
+// Failures returns the failed assertions and the errors.
+func (t *TestVar) Failures() []*Result {
+	ret := []*Result{}
+	for _, res := range t.Results {
+		if res.Type != RESULT_PASS {
+			ret = append(ret, res)
+		}
+	}
+	return ret
+}
+
+func (t *TestVar) count(resultType string) int {
+	n := 0
+	for _, res := range t.Results {
+		if res.Type == resultType {
+			n++
+		}
+	}
+	return n
+}
+
+// Description describes the failure as clojure.test does, along with the
+// diffs of the values.
+func (res *Result) Description() string {
+	var sb strings.Builder
+	if res.Context != "" {
+		fmt.Fprintln(&sb, res.Context)
+	}
+	if res.Message != "" {
+		fmt.Fprintln(&sb, res.Message)
+	}
+	if res.Expected != "" {
+		fmt.Fprintf(&sb, "expected: %s\n", res.Expected)
+	}
+	fmt.Fprintf(&sb, "  actual: %s\n", res.Actual)
+	for _, diff := range res.Diffs {
+		fmt.Fprintf(&sb, "    diff: - %s\n", diff.Removed)
+		fmt.Fprintf(&sb, "          + %s\n", diff.Added)
+	}
+	return sb.String()
+}
+
+func Summarize(tests []*TestVar) Summary {
+	s := Summary{}
+	nss := map[string]bool{}
+	for _, t := range tests {
+		nss[t.NS] = true
+		if t.Var != "" {
+			s.Vars++
+		}
+		s.Pass += t.count(RESULT_PASS)
+		s.Fail += t.count(RESULT_FAIL)
+		s.Error += t.count(RESULT_ERROR)
+	}
+	s.NS = len(nss)
+	s.Tests = s.Pass + s.Fail + s.Error
+	return s
+}
+
+// Succeeded reports whether no assertion failed and no error occurred.
+func (s Summary) Succeeded() bool {
+	return s.Fail == 0 && s.Error == 0
+}
+
+// testNSSuffix is the suffix of the namespaces discovered as test namespaces.
+const testNSSuffix = "-test"
+
+// Discover returns the test namespaces defined in the files under the
+// directory, sorted by name.
+func Discover(dir string) ([]string, error) {
+	nss := []string{}
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !hasSourceExtension(path) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if ns, _ := watcher.ParseNS(string(content)); strings.HasSuffix(ns, testNSSuffix) {
+			nss = append(nss, ns)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(nss)
+	return nss, nil
+}
+
+func hasSourceExtension(path string) bool {
+	for _, ext := range watcher.Extensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select resolves the targets into the namespaces to test, and narrows
+// down the tests in them to the vars. A target is a directory to discover
+// test namespaces from, a source file, or a namespace name. A var is
+// either a qualified symbol, which also adds its namespace to the targets,
+// or a simple one, which applies to all the namespaces.
+func Select(targets []string, vars []string) ([]Selection, error) {
+	nss := []string{}
+	for _, target := range targets {
+		info, err := os.Stat(target)
+		switch {
+		case err != nil:
+			nss = append(nss, target)
+		case info.IsDir():
+			found, err := Discover(target)
+			if err != nil {
+				return nil, err
+			}
+			nss = append(nss, found...)
+		default:
+			content, err := os.ReadFile(target)
+			if err != nil {
+				return nil, err
+			}
+			ns, _ := watcher.ParseNS(string(content))
+			if ns == "" {
+				return nil, fmt.Errorf("no ns form found in %s", target)
+			}
+			nss = append(nss, ns)
+		}
+	}
+	simpleVars := []string{}
+	qualifiedVars := map[string][]string{}
+	for _, v := range vars {
+		if i := strings.LastIndex(v, "/"); i > 0 {
+			ns := v[:i]
+			if _, ok := qualifiedVars[ns]; !ok && !contains(nss, ns) {
+				nss = append(nss, ns)
+			}
+			qualifiedVars[ns] = append(qualifiedVars[ns], v[i+1:])
+		} else {
+			simpleVars = append(simpleVars, v)
+		}
+	}
+	ret := []Selection{}
+	seen := map[string]bool{}
+	for _, ns := range nss {
+		if seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		sel := Selection{NS: ns}
+		sel.Vars = append(sel.Vars, simpleVars...)
+		sel.Vars = append(sel.Vars, qualifiedVars[ns]...)
+		if len(sel.Vars) == 0 && len(vars) > 0 {
+			// the vars are all qualified with the other namespaces
+			continue
+		}
+		ret = append(ret, sel)
+	}
+	return ret, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRunner creates a runner, which uses the test op if the server
+// supports it.
+func NewRunner(e Evaluator) *Runner {
+	return &Runner{evaluator: e, useOp: e.SupportsOp("test")}
+}
+
+// Run requires the namespace, reloading it, and runs the selected tests
+// in it. The failure to load the namespace is reported as an error result.
+func (r *Runner) Run(sel Selection) ([]*TestVar, error) {
+	code := fmt.Sprintf("(require '%s :reload)", sel.NS)
+	if _, err := r.evaluator.EvalForValue(code); err != nil {
+		if client.IsDisconnected(err) {
+			return nil, err
+		}
+		return []*TestVar{{
+			NS: sel.NS,
+			Results: []*Result{{
+				Type:    RESULT_ERROR,
+				Message: "failed to load namespace",
+				Actual:  err.Error(),
+			}},
+		}}, nil
+	}
+	if r.useOp {
+		return r.runWithOp(sel)
+	}
+	return r.runWithEval(sel)
+}
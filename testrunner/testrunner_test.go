@@ -0,0 +1,219 @@
+package testrunner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/athos/trenchman/bencode"
+	"github.com/athos/trenchman/client"
+	"github.com/athos/trenchman/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFile(t, filepath.Join(dir, "foo", "core_test.clj"), "(ns foo.core-test (:require [clojure.test :refer :all]))")
+	testutil.WriteFile(t, filepath.Join(dir, "foo", "util_test.cljc"), "(ns foo.util-test)")
+	testutil.WriteFile(t, filepath.Join(dir, "foo", "helpers.clj"), "(ns foo.helpers)")
+	testutil.WriteFile(t, filepath.Join(dir, ".hidden", "bar_test.clj"), "(ns bar-test)")
+	file := filepath.Join(dir, "foo", "helpers.clj")
+
+	tests := []struct {
+		title    string
+		targets  []string
+		vars     []string
+		expected []Selection
+	}{
+		{
+			"directory",
+			[]string{dir},
+			nil,
+			[]Selection{{NS: "foo.core-test"}, {NS: "foo.util-test"}},
+		},
+		{
+			"file and namespace",
+			[]string{file, "baz-test", "baz-test"},
+			nil,
+			[]Selection{{NS: "foo.helpers"}, {NS: "baz-test"}},
+		},
+		{
+			"simple vars",
+			[]string{dir},
+			[]string{"a-test"},
+			[]Selection{
+				{NS: "foo.core-test", Vars: []string{"a-test"}},
+				{NS: "foo.util-test", Vars: []string{"a-test"}},
+			},
+		},
+		{
+			"qualified vars",
+			[]string{dir},
+			[]string{"foo.core-test/a-test", "baz-test/b-test"},
+			[]Selection{
+				{NS: "foo.core-test", Vars: []string{"a-test"}},
+				{NS: "baz-test", Vars: []string{"b-test"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			sels, err := Select(tt.targets, tt.vars)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, sels)
+		})
+	}
+
+	testutil.WriteFile(t, filepath.Join(dir, "no_ns.clj"), "(println 42)")
+	_, err := Select([]string{filepath.Join(dir, "no_ns.clj")}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []*TestVar{
+		{NS: "foo-test", Var: "a", Results: []*Result{{Type: RESULT_PASS}, {Type: RESULT_FAIL}}},
+		{NS: "foo-test", Var: "b", Results: []*Result{{Type: RESULT_PASS}}},
+		{NS: "bar-test", Var: "", Results: []*Result{{Type: RESULT_ERROR}}},
+	}
+	s := Summarize(tests)
+	assert.Equal(t, Summary{NS: 2, Vars: 2, Tests: 4, Pass: 2, Fail: 1, Error: 1}, s)
+	assert.False(t, s.Succeeded())
+	assert.True(t, Summarize(tests[1:2]).Succeeded())
+	assert.Equal(t, []*Result{{Type: RESULT_FAIL}}, tests[0].Failures())
+}
+
+func TestDescription(t *testing.T) {
+	res := &Result{
+		Type:     RESULT_FAIL,
+		Context:  "arithmetic",
+		Expected: "(= 3 (+ 1 1))",
+		Actual:   "(not (= 3 2))",
+		Diffs:    []Diff{{Actual: "2", Removed: "3", Added: "2"}},
+	}
+	assert.Equal(t, "arithmetic\n"+
+		"expected: (= 3 (+ 1 1))\n"+
+		"  actual: (not (= 3 2))\n"+
+		"    diff: - 3\n"+
+		"          + 2\n", res.Description())
+}
+
+type mockEvaluator struct {
+	ops       map[string]bool
+	values    map[string]string
+	errs      map[string]error
+	responses []map[string]interface{}
+	codes     []string
+	reqs      []map[string]interface{}
+	drained   chan struct{}
+}
+
+func (e *mockEvaluator) SupportsOp(op string) bool {
+	return e.ops[op]
+}
+
+func (e *mockEvaluator) EvalForValue(code string) (string, error) {
+	e.codes = append(e.codes, code)
+	if err, ok := e.errs[code]; ok {
+		return "", err
+	}
+	if value, ok := e.values[code]; ok {
+		return value, nil
+	}
+	return "nil", nil
+}
+
+func (e *mockEvaluator) SendOp(req map[string]interface{}) (<-chan map[string]interface{}, bool) {
+	e.reqs = append(e.reqs, req)
+	// unbuffered as the nREPL client's, so that it blocks unless all the
+	// responses are received
+	ch := make(chan map[string]interface{})
+	e.drained = make(chan struct{})
+	go func() {
+		for _, resp := range e.responses {
+			ch <- resp
+		}
+		close(ch)
+		close(e.drained)
+	}()
+	return ch, true
+}
+
+func TestRunWithOp(t *testing.T) {
+	e := &mockEvaluator{
+		ops: map[string]bool{"test": true},
+		responses: []map[string]interface{}{
+			{
+				"results": map[string]bencode.Datum{
+					"foo-test": map[string]bencode.Datum{
+						"a-test": []bencode.Datum{
+							map[string]bencode.Datum{"type": "pass"},
+						},
+					},
+				},
+			},
+			{"status": []bencode.Datum{"done"}},
+		},
+	}
+	tests, err := NewRunner(e).Run(Selection{NS: "foo-test", Vars: []string{"a-test"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"(require 'foo-test :reload)"}, e.codes)
+	assert.Equal(t, []map[string]interface{}{
+		{"op": "test", "ns": "foo-test", "tests": []bencode.Datum{"a-test"}},
+	}, e.reqs)
+	assert.Equal(t, []*TestVar{
+		{NS: "foo-test", Var: "a-test", Results: []*Result{{Type: RESULT_PASS}}},
+	}, tests)
+}
+
+func TestRunWithOpNamespaceNotFound(t *testing.T) {
+	e := &mockEvaluator{
+		ops: map[string]bool{"test": true},
+		responses: []map[string]interface{}{
+			{"status": []bencode.Datum{"namespace-not-found"}},
+			{"status": []bencode.Datum{"done"}},
+		},
+	}
+	_, err := NewRunner(e).Run(Selection{NS: "foo-test"})
+	assert.EqualError(t, err, "namespace not found: foo-test")
+	select {
+	case <-e.drained:
+	case <-time.After(time.Second):
+		t.Fatal("the responses to the op were not all received")
+	}
+}
+
+func TestRunWithEval(t *testing.T) {
+	sel := Selection{NS: "foo-test"}
+	e := &mockEvaluator{
+		values: map[string]string{
+			runTestsInvocation(sel): `"[{:type \"begin-test-var\", :ns \"foo-test\", :var \"a-test\"}]"`,
+		},
+	}
+	tests, err := NewRunner(e).Run(sel)
+	assert.Nil(t, err)
+	assert.Empty(t, e.reqs)
+	assert.Equal(t, []*TestVar{{NS: "foo-test", Var: "a-test"}}, tests)
+}
+
+func TestRunLoadFailure(t *testing.T) {
+	e := &mockEvaluator{
+		errs: map[string]error{
+			"(require 'foo-test :reload)": client.NewRuntimeError("Syntax error compiling"),
+		},
+	}
+	tests, err := NewRunner(e).Run(Selection{NS: "foo-test"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*TestVar{{
+		NS: "foo-test",
+		Results: []*Result{{
+			Type:    RESULT_ERROR,
+			Message: "failed to load namespace",
+			Actual:  "Syntax error compiling",
+		}},
+	}}, tests)
+	assert.Len(t, e.codes, 1)
+
+	e.errs["(require 'foo-test :reload)"] = client.ErrDisconnected
+	_, err = NewRunner(e).Run(Selection{NS: "foo-test"})
+	assert.Equal(t, client.ErrDisconnected, err)
+}
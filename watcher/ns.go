@@ -0,0 +1,81 @@
+package watcher
+
+import "github.com/athos/trenchman/reader"
+
+// maxFormsBeforeNS is the number of top-level forms to look through for
+// the ns form.
+const maxFormsBeforeNS = 5
+
+// ParseNS finds the ns form in the content and returns the name of the
+// namespace and the namespaces it requires. The name is empty if the ns
+// form is not found.
+func ParseNS(content string) (name string, requires []string) {
+	r := reader.NewReader([]rune(content), true)
+	for i := 0; i < maxFormsBeforeNS; i++ {
+		form, err := r.Read()
+		if err != nil {
+			return "", nil
+		}
+		l, ok := form.(reader.List)
+		if !ok || len(l) < 2 || l[0] != reader.Symbol("ns") {
+			continue
+		}
+		if name, ok := l[1].(reader.Symbol); ok {
+			return string(name), nsRequires(l[2:])
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+func nsRequires(clauses []interface{}) []string {
+	ret := []string{}
+	for _, clause := range clauses {
+		l, ok := clause.(reader.List)
+		if !ok || len(l) == 0 {
+			continue
+		}
+		switch l[0] {
+		case reader.Keyword("require"), reader.Keyword("use"):
+			for _, spec := range l[1:] {
+				ret = appendLibs(ret, "", spec)
+			}
+		}
+	}
+	return ret
+}
+
+// appendLibs appends the names of the libs in the libspec or the prefix
+// list, as clojure.core/load-libs interprets them.
+func appendLibs(libs []string, prefix string, spec interface{}) []string {
+	var elems []interface{}
+	switch spec := spec.(type) {
+	case reader.Symbol:
+		return append(libs, prefix+string(spec))
+	case reader.Vector:
+		elems = spec
+	case reader.List:
+		elems = spec
+	default:
+		return libs
+	}
+	if len(elems) == 0 {
+		return libs
+	}
+	head, ok := elems[0].(reader.Symbol)
+	if !ok {
+		return libs
+	}
+	if _, isVector := spec.(reader.Vector); isVector {
+		if len(elems) == 1 {
+			return append(libs, prefix+string(head))
+		}
+		if _, ok := elems[1].(reader.Keyword); ok {
+			return append(libs, prefix+string(head))
+		}
+	}
+	for _, elem := range elems[1:] {
+		libs = appendLibs(libs, prefix+string(head)+".", elem)
+	}
+	return libs
+}
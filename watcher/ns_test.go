@@ -0,0 +1,66 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNS(t *testing.T) {
+	tests := []struct {
+		title    string
+		content  string
+		name     string
+		requires []string
+	}{
+		{
+			"simple",
+			"(ns foo.core\n  (:require [foo.util :as u]\n            foo.db\n            [clojure.string :refer [join]]))",
+			"foo.core",
+			[]string{"foo.util", "foo.db", "clojure.string"},
+		},
+		{
+			"metadata, docstring and comments",
+			";; header\n(ns ^:no-doc foo.core\n  \"Docstring with (parens)\"\n  {:author \"me\"}\n  (:require [foo.util]) ; comment\n  (:use foo.legacy)\n  (:import [java.io File]))",
+			"foo.core",
+			[]string{"foo.util", "foo.legacy"},
+		},
+		{
+			"prefix lists",
+			"(ns foo.core (:require (foo util [db :as db]) [foo.web handler [routes :refer :all]]))",
+			"foo.core",
+			[]string{"foo.util", "foo.db", "foo.web.handler", "foo.web.routes"},
+		},
+		{
+			"reader conditionals",
+			"(ns foo.core (:require #?(:clj [foo.jvm] :cljs [foo.js]) #_[foo.ignored] [foo.common]))",
+			"foo.core",
+			[]string{"foo.jvm", "foo.common"},
+		},
+		{
+			"shebang and forms before ns",
+			"#!/usr/bin/env bb\n(set! *warn-on-reflection* true)\n(ns foo.script (:require [foo.util]))",
+			"foo.script",
+			[]string{"foo.util"},
+		},
+		{
+			"no ns form",
+			"(println \"Hello\")",
+			"",
+			nil,
+		},
+		{
+			"incomplete ns form",
+			"(ns foo.core (:require [foo.util]",
+			"",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			name, requires := ParseNS(tt.content)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.requires, requires)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+// Package watcher detects changes to Clojure source files by polling, and
+// orders the files to reload according to the dependencies among their
+// namespaces.
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Extensions are the extensions of the files watched in directories.
+// Files given explicitly are watched regardless of their extensions.
+var Extensions = []string{".clj", ".cljc"}
+
+type (
+	Watcher struct {
+		paths []string
+		files map[string]*file
+	}
+
+	file struct {
+		modTime  time.Time
+		size     int64
+		ns       string
+		requires []string
+	}
+)
+
+// New creates a watcher for the files and directories at the paths, and
+// takes a snapshot of them.
+func New(paths []string) (*Watcher, error) {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+	w := &Watcher{paths: paths, files: map[string]*file{}}
+	if _, err := w.Poll(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func watched(path string) bool {
+	for _, ext := range Extensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) walk(f func(path string, info fs.FileInfo)) error {
+	for _, root := range w.paths {
+		err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				// the file may have been removed while walking
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				if path != root && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if path == root || watched(path) {
+				f(path, info)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Poll returns the files created or modified since the last poll.
+func (w *Watcher) Poll() ([]string, error) {
+	changed := []string{}
+	seen := map[string]bool{}
+	err := w.walk(func(path string, info fs.FileInfo) {
+		seen[path] = true
+		f, ok := w.files[path]
+		if ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+			return
+		}
+		f = &file{modTime: info.ModTime(), size: info.Size()}
+		if content, err := os.ReadFile(path); err == nil {
+			f.ns, f.requires = ParseNS(string(content))
+		}
+		w.files[path] = f
+		changed = append(changed, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for path := range w.files {
+		if !seen[path] {
+			delete(w.files, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// Files returns the files being watched, sorted by path.
+func (w *Watcher) Files() []string {
+	ret := make([]string, 0, len(w.files))
+	for path := range w.files {
+		ret = append(ret, path)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Namespace returns the name of the namespace defined in the file, or an
+// empty string if unknown.
+func (w *Watcher) Namespace(path string) string {
+	if f, ok := w.files[path]; ok {
+		return f.ns
+	}
+	return ""
+}
+
+// Watch polls the files at the interval until stop is closed, and calls
+// onChange with the files to reload whenever some of them have changed.
+func (w *Watcher) Watch(interval time.Duration, stop <-chan struct{}, onChange func([]string)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			changed, err := w.Poll()
+			if err != nil {
+				return err
+			}
+			if len(changed) > 0 {
+				onChange(w.ReloadOrder(changed))
+			}
+		}
+	}
+}
+
+// ReloadOrder returns the changed files along with the files depending on
+// them, ordered so that each file comes after the files it depends on.
+func (w *Watcher) ReloadOrder(changed []string) []string {
+	nsFiles := map[string]string{}
+	for path, f := range w.files {
+		if f.ns != "" {
+			nsFiles[f.ns] = path
+		}
+	}
+	deps := map[string][]string{}
+	dependents := map[string][]string{}
+	for path, f := range w.files {
+		for _, ns := range f.requires {
+			if dep, ok := nsFiles[ns]; ok && dep != path {
+				deps[path] = append(deps[path], dep)
+				dependents[dep] = append(dependents[dep], path)
+			}
+		}
+	}
+
+	targets := map[string]bool{}
+	var mark func(string)
+	mark = func(path string) {
+		if targets[path] {
+			return
+		}
+		targets[path] = true
+		for _, dependent := range dependents[path] {
+			mark(dependent)
+		}
+	}
+	for _, path := range changed {
+		mark(path)
+	}
+	paths := make([]string, 0, len(targets))
+	for path := range targets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ret := make([]string, 0, len(paths))
+	visited := map[string]bool{}
+	var visit func(string)
+	visit = func(path string) {
+		if visited[path] {
+			return
+		}
+		// marked before visiting the deps so that cycles terminate
+		visited[path] = true
+		for _, dep := range deps[path] {
+			if targets[dep] {
+				visit(dep)
+			}
+		}
+		ret = append(ret, path)
+	}
+	for _, path := range paths {
+		visit(path)
+	}
+	return ret
+}
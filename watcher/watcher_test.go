@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/athos/trenchman/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// touch updates the file with a modification time that surely differs
+// from the previous one.
+func touch(t *testing.T, path, content string) {
+	t.Helper()
+	testutil.WriteFile(t, path, content)
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	core := filepath.Join(src, "foo", "core.clj")
+	util := filepath.Join(src, "foo", "util.cljc")
+	testutil.WriteFile(t, core, "(ns foo.core)")
+	testutil.WriteFile(t, util, "(ns foo.util)")
+	testutil.WriteFile(t, filepath.Join(src, "foo", "README.md"), "")
+	testutil.WriteFile(t, filepath.Join(src, ".hidden", "bar.clj"), "(ns bar)")
+
+	w, err := New([]string{src})
+	assert.Nil(t, err)
+	changed, err := w.Poll()
+	assert.Nil(t, err)
+	assert.Empty(t, changed)
+
+	touch(t, util, "(ns foo.util) (def x 1)")
+	newFile := filepath.Join(src, "foo", "new.clj")
+	testutil.WriteFile(t, newFile, "(ns foo.new)")
+	changed, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{newFile, util}, changed)
+
+	assert.Nil(t, os.Remove(newFile))
+	changed, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Empty(t, changed)
+	assert.NotContains(t, w.files, newFile)
+
+	_, err = New([]string{filepath.Join(dir, "missing")})
+	assert.NotNil(t, err)
+}
+
+func TestReloadOrder(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	testutil.WriteFile(t, path("a.clj"), "(ns app.a (:require [app.c] [app.b]))")
+	testutil.WriteFile(t, path("b.clj"), "(ns app.b (:require [app.c]))")
+	testutil.WriteFile(t, path("c.clj"), "(ns app.c (:require [clojure.string]))")
+	testutil.WriteFile(t, path("d.clj"), "(ns app.d)")
+	testutil.WriteFile(t, path("script.clj"), "(println :hello)")
+	w, err := New([]string{dir})
+	assert.Nil(t, err)
+
+	assert.Equal(t,
+		[]string{path("c.clj"), path("b.clj"), path("a.clj")},
+		w.ReloadOrder([]string{path("c.clj")}),
+	)
+	assert.Equal(t,
+		[]string{path("b.clj"), path("a.clj"), path("d.clj")},
+		w.ReloadOrder([]string{path("d.clj"), path("b.clj")}),
+	)
+	assert.Equal(t,
+		[]string{path("script.clj")},
+		w.ReloadOrder([]string{path("script.clj")}),
+	)
+
+	// cyclic dependencies don't prevent reloading
+	touch(t, path("c.clj"), "(ns app.c (:require [app.a]))")
+	changed, err := w.Poll()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t,
+		[]string{path("a.clj"), path("b.clj"), path("c.clj")},
+		w.ReloadOrder(changed),
+	)
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "foo.clj")
+	testutil.WriteFile(t, path, "(ns foo)")
+	w, err := New([]string{dir})
+	assert.Nil(t, err)
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	reloaded := make(chan []string, 1)
+	go func() {
+		done <- w.Watch(10*time.Millisecond, stop, func(files []string) {
+			reloaded <- files
+		})
+	}()
+	touch(t, path, "(ns foo) (def x 1)")
+	select {
+	case files := <-reloaded:
+		assert.Equal(t, []string{path}, files)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not detected")
+	}
+	close(stop)
+	assert.Nil(t, <-done)
+}